@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// fileBackup saves files and their metadata into a directory before deleting them.
+//
+// A file F0123 is saved as
+//
+//	DIR/F0123.json     metadata (slack.File)
+//	DIR/F0123/NAME     content
+//
+// and recorded in the manifest of DIR.
+type fileBackup struct {
+	dir   string
+	token string
+
+	mu       sync.Mutex
+	manifest *manifest
+}
+
+// backupDir returns the backup directory of --backup, or of the config unless noBackup.
+func backupDir(option string, noBackup bool, config *config) string {
+	if noBackup {
+		return ""
+	}
+	if option != "" {
+		return option
+	}
+	return config.Backup.Dir
+}
+
+// newFileBackup returns nil if dir is empty.
+func newFileBackup(dir, token string) (*fileBackup, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	m, err := loadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileBackup{
+		dir:      dir,
+		token:    token,
+		manifest: m,
+	}, nil
+}
+
+// save downloads f and writes its metadata.
+// External files (e.g. Google Docs) have no content and only the metadata is written.
+func (b *fileBackup) save(f slack.File) error {
+	if f.URLPrivateDownload != "" || !f.IsExternal {
+		name := sanitizeFileName(f.Name)
+		if name == "" {
+			name = sanitizeFileName(f.ID)
+		}
+		path := filepath.Join(b.dir, sanitizeFileName(f.ID), name)
+
+		sum, err := downloadToFile(b.token, f, path, nil)
+		if err != nil {
+			return err
+		}
+
+		b.mu.Lock()
+		err = b.manifest.add(f, path, sum)
+		if err == nil {
+			err = b.manifest.save()
+		}
+		b.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	meta, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(b.dir, sanitizeFileName(f.ID)+".json"), meta, 0644)
+}
+
+// backupEntry is a file saved in a backup.
+type backupEntry struct {
+	File slack.File
+	// Path is the content. Empty for external files.
+	Path string
+}
+
+// loadBackup reads files saved in dir by fileBackup, in the order of Created.
+func loadBackup(dir string) ([]backupEntry, error) {
+	m, err := loadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]string, len(m.Files))
+	for key, e := range m.Files {
+		paths[e.ID] = m.path(key)
+	}
+
+	metas, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []backupEntry
+	for _, meta := range metas {
+		if strings.HasPrefix(filepath.Base(meta), ".") {
+			continue
+		}
+
+		b, err := os.ReadFile(meta)
+		if err != nil {
+			return nil, err
+		}
+		var f slack.File
+		if err := json.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("broken metadata %v: %v", meta, err)
+		}
+		if f.ID == "" {
+			continue
+		}
+
+		entries = append(entries, backupEntry{File: f, Path: paths[f.ID]})
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no backup in %v", dir)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].File.Created < entries[j].File.Created
+	})
+
+	return entries, nil
+}
+
+// backupError is a failure of backup, and the file is not deleted.
+type backupError struct {
+	err error
+}
+
+func (e backupError) Error() string {
+	return fmt.Sprintf("backup failed, not deleted: %v", e.err)
+}
+
+func (e backupError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// fileCache is a local copy of the file list and the names of a workspace.
+//
+// It is stored as JSON under the user cache dir, one for each access token.
+type fileCache struct {
+	Updated time.Time    `json:"updated"`
+	Files   []slack.File `json:"files"`
+
+	Channels map[string]string `json:"channels,omitempty"`
+	Users    map[string]string `json:"users,omitempty"`
+	UserIDs  map[string]string `json:"user_ids,omitempty"`
+
+	path    string
+	offline bool
+}
+
+// openFileCache loads the cache and refreshes it according to the global options.
+// It returns nil if no cache option is given.
+//
+// An incremental refresh fetches new files only, so files changed or deleted since they were cached
+// remain stale until a full refresh (--refresh, or openFileCacheToDelete).
+func openFileCache(global globalCmd, client *slackClient, token string) (*fileCache, error) {
+	return openFileCacheWithRefresh(global, client, token, global.Refresh)
+}
+
+// openFileCacheToDelete is openFileCache for commands deleting files.
+// The cache is refreshed fully not to delete files by stale properties.
+func openFileCacheToDelete(global globalCmd, client *slackClient, token string) (*fileCache, error) {
+	if global.Offline {
+		return nil, errors.New("--offline can not be used to delete files")
+	}
+	return openFileCacheWithRefresh(global, client, token, true)
+}
+
+func openFileCacheWithRefresh(global globalCmd, client *slackClient, token string, full bool) (*fileCache, error) {
+	if !global.Cache && !global.Refresh && !global.Offline {
+		return nil, nil
+	}
+
+	cache, err := loadFileCache(token)
+	if err != nil {
+		return nil, err
+	}
+	cache.offline = global.Offline
+
+	switch {
+	case global.Offline:
+		if cache.Updated.IsZero() {
+			return nil, errors.New("no cache for --offline. run with --cache first")
+		}
+	case full:
+		err = cache.refresh(client, true)
+	case time.Since(cache.Updated) >= global.CacheTTL:
+		err = cache.refresh(client, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+func fileCachePath(token string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(token))
+	return filepath.Join(dir, "slack-file", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func loadFileCache(token string) (*fileCache, error) {
+	path, err := fileCachePath(token)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &fileCache{path: path}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, cache); err != nil {
+		return nil, fmt.Errorf("broken cache %v (retry with --refresh): %v", path, err)
+	}
+
+	return cache, nil
+}
+
+func (c *fileCache) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// refresh fetches files newer than the newest one in the cache, or all files if full.
+func (c *fileCache) refresh(client *slackClient, full bool) error {
+	params := newListFilesParams("", "", "", 0, 0)
+
+	if full {
+		c.Files = nil
+		c.Channels = nil
+		c.Users = nil
+		c.UserIDs = nil
+	} else {
+		for _, f := range c.Files {
+			if f.Created > params.TimestampFrom {
+				params.TimestampFrom = f.Created
+			}
+		}
+	}
+
+	started := time.Now()
+
+	files, err := listFiles(client, params)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string]int, len(c.Files))
+	for i, f := range c.Files {
+		index[f.ID] = i
+	}
+	for _, f := range files {
+		if i, found := index[f.ID]; found {
+			c.Files[i] = f
+		} else {
+			index[f.ID] = len(c.Files)
+			c.Files = append(c.Files, f)
+		}
+	}
+
+	c.Updated = started
+	return c.save()
+}
+
+// remove removes files of ids (e.g. deleted) from the cache.
+func (c *fileCache) remove(ids ...string) error {
+	if c == nil || len(ids) == 0 {
+		return nil
+	}
+
+	removed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		removed[id] = true
+	}
+
+	files := c.Files[:0]
+	for _, f := range c.Files {
+		if !removed[f.ID] {
+			files = append(files, f)
+		}
+	}
+	c.Files = files
+
+	return c.save()
+}
+
+// selectFiles returns cached files filtered as files.list does with params.
+func (c *fileCache) selectFiles(params slack.GetFilesParameters) []slack.File {
+	var files []slack.File
+	for _, f := range c.Files {
+		if matchListFilesParams(f, params) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func matchListFilesParams(f slack.File, params slack.GetFilesParameters) bool {
+	if params.Channel != "" && !containsString(f.Channels, params.Channel) &&
+		!containsString(f.Groups, params.Channel) && !containsString(f.IMs, params.Channel) {
+		return false
+	}
+
+	if params.User != "" && f.User != params.User {
+		return false
+	}
+
+	if params.TimestampFrom != slack.DEFAULT_FILES_TS_FROM && f.Created < params.TimestampFrom {
+		return false
+	}
+	if params.TimestampTo != slack.DEFAULT_FILES_TS_TO && f.Created > params.TimestampTo {
+		return false
+	}
+
+	if params.Types == "" || params.Types == slack.DEFAULT_FILES_TYPES {
+		return true
+	}
+	for _, t := range strings.Split(params.Types, ",") {
+		if matchFileType(f, strings.TrimSpace(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFileType tests f is of t, a type of files.list.
+func matchFileType(f slack.File, t string) bool {
+	switch strings.ToLower(t) {
+	case "all":
+		return true
+	case "spaces":
+		return f.Mode == "space" || f.Mode == "post" || f.Filetype == "space" || f.Filetype == "post"
+	case "snippets":
+		return f.Mode == "snippet"
+	case "images":
+		return strings.HasPrefix(f.Mimetype, "image/")
+	case "gdocs":
+		return f.ExternalType == "gdrive"
+	case "zips":
+		return f.Filetype == "zip"
+	case "pdfs":
+		return f.Filetype == "pdf"
+	default:
+		return false
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
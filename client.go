@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// maxRetries is the number of retries of an API call.
+const maxRetries = 5
+
+// apiTiers are requests per minute of the methods.
+// https://api.slack.com/docs/rate-limits
+var apiTiers = map[string]int{
+	"conversations.list":  20, // Tier 2
+	"users.list":          20, // Tier 2
+	"users.conversations": 50, // Tier 3
+	"files.list":          50, // Tier 3
+	"files.delete":        50, // Tier 3
+}
+
+// slackClient is a slack.Client that keeps the rate limit of each method and
+// retries rate limited (honouring Retry-After), 5xx and network errors with backoff.
+type slackClient struct {
+	client *slack.Client
+
+	// token and apiURL are for methods not in slack.Client.
+	token  string
+	apiURL string
+
+	mu       sync.Mutex
+	limiters map[string]*rateLimiter
+}
+
+func newSlackClient(token string) *slackClient {
+	return &slackClient{
+		client:   slack.New(token),
+		token:    token,
+		apiURL:   slack.APIURL,
+		limiters: make(map[string]*rateLimiter),
+	}
+}
+
+func (c *slackClient) limiter(method string) *rateLimiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, found := c.limiters[method]
+	if !found {
+		perMinute := apiTiers[method]
+		if perMinute == 0 {
+			perMinute = 100 // Tier 4
+		}
+		l = &rateLimiter{interval: time.Minute / time.Duration(perMinute)}
+		c.limiters[method] = l
+	}
+	return l
+}
+
+// call calls fn as method, retrying on retryable errors.
+func (c *slackClient) call(method string, fn func() error) error {
+	l := c.limiter(method)
+
+	for attempt := 0; ; attempt++ {
+		l.wait()
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		wait, retryable := retryWait(err, attempt)
+		if !retryable || attempt >= maxRetries {
+			return err
+		}
+		time.Sleep(wait)
+	}
+}
+
+// retryWait returns how long to wait before the next attempt, or false if err is not retryable.
+func retryWait(err error, attempt int) (time.Duration, bool) {
+	var rlerr *slack.RateLimitedError
+	if errors.As(err, &rlerr) {
+		return rlerr.RetryAfter + time.Second, true
+	}
+
+	backoff := backoffWait(attempt)
+
+	var scerr interface{ HTTPStatusCode() int }
+	if errors.As(err, &scerr) {
+		return backoff, scerr.HTTPStatusCode() >= 500
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return backoff, true
+	}
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return backoff, true
+	}
+
+	return 0, false
+}
+
+// backoffWait returns an exponential backoff with jitter, up to 30s.
+func backoffWait(attempt int) time.Duration {
+	backoff := time.Second << attempt
+	if backoff > 30*time.Second {
+		backoff = 30 * time.Second
+	}
+	return backoff + time.Duration(rand.Int63n(int64(time.Second)))
+}
+
+// rateLimiter spaces calls by interval.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *rateLimiter) wait() {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// API methods
+
+func (c *slackClient) GetFiles(params slack.GetFilesParameters) (files []slack.File, paging *slack.Paging, err error) {
+	err = c.call("files.list", func() error {
+		files, paging, err = c.client.GetFiles(params)
+		return err
+	})
+	return files, paging, err
+}
+
+func (c *slackClient) DeleteFile(fileID string) error {
+	retried := false
+	return c.call("files.delete", func() error {
+		err := c.client.DeleteFile(fileID)
+		// the previous attempt may have deleted it
+		if retried && isFileGone(err) {
+			return nil
+		}
+		retried = true
+		return err
+	})
+}
+
+// isFileGone tests err is file_not_found or file_deleted of the API.
+func isFileGone(err error) bool {
+	var serr slack.SlackErrorResponse
+	return errors.As(err, &serr) && (serr.Err == "file_not_found" || serr.Err == "file_deleted")
+}
+
+func (c *slackClient) GetFileInfo(fileID string) (file *slack.File, err error) {
+	err = c.call("files.info", func() error {
+		file, _, _, err = c.client.GetFileInfo(fileID, 0, 0)
+		return err
+	})
+	return file, err
+}
+
+func (c *slackClient) GetConversations(params *slack.GetConversationsParameters) (chans []slack.Channel, nextCursor string, err error) {
+	err = c.call("conversations.list", func() error {
+		chans, nextCursor, err = c.client.GetConversations(params)
+		return err
+	})
+	return chans, nextCursor, err
+}
+
+func (c *slackClient) GetConversationsForUser(params *slack.GetConversationsForUserParameters) (chans []slack.Channel, nextCursor string, err error) {
+	err = c.call("users.conversations", func() error {
+		chans, nextCursor, err = c.client.GetConversationsForUser(params)
+		return err
+	})
+	return chans, nextCursor, err
+}
+
+func (c *slackClient) OpenConversation(params *slack.OpenConversationParameters) (ch *slack.Channel, err error) {
+	err = c.call("conversations.open", func() error {
+		ch, _, _, err = c.client.OpenConversation(params)
+		return err
+	})
+	return ch, err
+}
+
+func (c *slackClient) GetUsers() (users []slack.User, err error) {
+	err = c.call("users.list", func() error {
+		users, err = c.client.GetUsers()
+		return err
+	})
+	return users, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// API methods not in slack.Client
+
+// apiStatusError is an HTTP error status of an API call.
+type apiStatusError struct {
+	Method string
+	Code   int
+	Status string
+}
+
+func (e apiStatusError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Method, e.Status)
+}
+
+func (e apiStatusError) HTTPStatusCode() int {
+	return e.Code
+}
+
+// post calls method with values, and decodes the response into resp.
+func (c *slackClient) post(method string, values url.Values, resp interface{ Err() error }) error {
+	req, err := http.NewRequest("POST", c.apiURL+method, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	hresp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+
+	if hresp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := strconv.Atoi(hresp.Header.Get("Retry-After"))
+		return &slack.RateLimitedError{RetryAfter: time.Duration(retryAfter) * time.Second}
+	}
+	if hresp.StatusCode != http.StatusOK {
+		return apiStatusError{Method: method, Code: hresp.StatusCode, Status: hresp.Status}
+	}
+
+	if err := json.NewDecoder(hresp.Body).Decode(resp); err != nil {
+		return fmt.Errorf("%v: %v", method, err)
+	}
+	return resp.Err()
+}
+
+// GetUploadURLExternal returns a URL to upload a file of length bytes, and the ID of the file.
+// snippetType makes the file a snippet (e.g. go, text).
+func (c *slackClient) GetUploadURLExternal(filename string, length int64, snippetType string) (uploadURL, fileID string, err error) {
+	values := url.Values{
+		"filename": {filename},
+		"length":   {strconv.FormatInt(length, 10)},
+	}
+	if snippetType != "" {
+		values.Set("snippet_type", snippetType)
+	}
+
+	var resp struct {
+		slack.SlackResponse
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	err = c.call("files.getUploadURLExternal", func() error {
+		return c.post("files.getUploadURLExternal", values, &resp)
+	})
+	return resp.UploadURL, resp.FileID, err
+}
+
+// completeUploadParameters are the parameters of files.completeUploadExternal.
+type completeUploadParameters struct {
+	FileID string
+	Title  string
+
+	// Channels are IDs. The file is private if empty.
+	Channels        []string
+	InitialComment  string
+	ThreadTimestamp string
+}
+
+// CompleteUploadExternal finishes an upload and shares the file.
+func (c *slackClient) CompleteUploadExternal(params completeUploadParameters) (*slack.File, error) {
+	files, err := json.Marshal([]map[string]string{{"id": params.FileID, "title": params.Title}})
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{
+		"files": {string(files)},
+	}
+	if len(params.Channels) != 0 {
+		values.Set("channels", strings.Join(params.Channels, ","))
+	}
+	if params.InitialComment != "" {
+		values.Set("initial_comment", params.InitialComment)
+	}
+	if params.ThreadTimestamp != "" {
+		values.Set("thread_ts", params.ThreadTimestamp)
+	}
+
+	var resp struct {
+		slack.SlackResponse
+		Files []slack.File `json:"files"`
+	}
+	err = c.call("files.completeUploadExternal", func() error {
+		return c.post("files.completeUploadExternal", values, &resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Files) == 0 {
+		return nil, errors.New("files.completeUploadExternal: no file returned")
+	}
+	return &resp.Files[0], nil
+}
+
+// UploadExternalContent sends length bytes of open() to uploadURL.
+// open is called again for each retry.
+func (c *slackClient) UploadExternalContent(uploadURL string, length int64, open func() (io.ReadCloser, error)) error {
+	for attempt := 0; ; attempt++ {
+		err := c.uploadExternalContent(uploadURL, length, open)
+		if err == nil {
+			return nil
+		}
+
+		wait, retryable := retryWait(err, attempt)
+		if !retryable || attempt >= maxRetries {
+			return err
+		}
+		time.Sleep(wait)
+	}
+}
+
+func (c *slackClient) uploadExternalContent(uploadURL string, length int64, open func() (io.ReadCloser, error)) error {
+	body, err := open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	req, err := http.NewRequest("POST", uploadURL, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return apiStatusError{Method: "upload", Code: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
@@ -2,62 +2,56 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"sort"
-	"strings"
 	"time"
 
-	"github.com/gobwas/glob"
 	"github.com/shu-go/gli"
-	"github.com/slack-go/slack"
 )
 
 type deleteCmd struct {
-	_ struct{} `help:"delete files" usage:"# delete by pattern\nslack-file delete my*.txt\n# files older than 1day\nslack-file delete --older 24h *\n# files in a general channel\nslack-file delete --chan general *"`
+	_ struct{} `help:"delete files" usage:"# delete by pattern\nslack-file delete my*.txt\n# files older than 1day\nslack-file delete --older 24h *\n# files in a general channel\nslack-file delete --chan general *\n# check targets\nslack-file delete --dry-run --table *"`
 
 	Target gli.StrList   `default:"Name,Title,ID"`
-	Older  time.Duration `cli:"older-than,older" help:"Timestamp (e.g. '24h' for 1-day)"`
+	Older  time.Duration `cli:"older-than,older" help:"created before (e.g. '24h' for 1-day ago)"`
+	Newer  time.Duration `cli:"newer-than,newer" help:"created after (e.g. '24h' for 1-day ago)"`
 
-	Chan      string `help:"a channel name"`
-	innerChan string
+	Chan  string `help:"a channel name"`
+	User  string `help:"a user name or ID"`
+	Types string `help:"comma separated file types (spaces,snippets,images,gdocs,zips,pdfs)"`
+	Where string `help:"filter expression (e.g. 'size > 10MB && filetype == \"png\" && !isstarred && created < -30d')"`
 
 	DryRun bool `cli:"dry-run" help:"do not delete files actually"`
 
+	Parallel int  `default:"4" help:"the number of files deleted at once"`
+	FailFast bool `cli:"fail-fast" help:"stop deleting after the first failure"`
+
+	Backup   string `cli:"backup=DIR" help:"download files and their metadata into DIR before deleting (default: Backup.Dir in the config)"`
+	NoBackup bool   `cli:"no-backup" help:"do not backup even if Backup.Dir is in the config"`
+
 	Format string `default:"{{.ID}}\t{{.Timestamp.Time}}\t{{.Name}}"`
+
+	Table        bool        `help:"print aligned columns instead of --format"`
+	Columns      gli.StrList `help:"properties in --table (default: ID,Created,Size,Filetype,Name)"`
+	RelativeTime bool        `cli:"relative-time,rel" help:"print times as '3 days ago' in --table"`
 }
 
 func init() {
 	gApp.AddExtraCommand(&deleteCmd{}, "delete,del,remove,rm", "")
 }
 
-func (c *deleteCmd) Before(global globalCmd) error {
-	if c.Chan != "" {
-		config, _ := loadConfig(global.Config)
-
-		if config.Slack.AccessToken == "" {
-			return errors.New("auth first")
-		}
-
-		sl := slack.New(config.Slack.AccessToken)
-
-		params := slack.GetConversationsForUserParameters{
-			Types: []string{"public_channel", "private_channel"},
-		}
-		chans, err := listConversationsForUser(sl, params)
-		if err != nil {
-			return err
-		}
-
-		for _, ch := range chans {
-			if strings.EqualFold(c.Chan, ch.Name) {
-				c.innerChan = ch.ID
-			}
-		}
-
-		if c.innerChan == "" {
-			return errors.New("no channel " + c.Chan + " found")
-		}
+// selection returns the options selecting files.
+func (c deleteCmd) selection() selectionFlags {
+	return selectionFlags{
+		Target: c.Target,
+		Older:  c.Older,
+		Newer:  c.Newer,
+		Chan:   c.Chan,
+		User:   c.User,
+		Types:  c.Types,
+		Where:  c.Where,
 	}
-	return nil
 }
 
 func (c deleteCmd) Run(global globalCmd, args []string) error {
@@ -67,11 +61,29 @@ func (c deleteCmd) Run(global globalCmd, args []string) error {
 		return errors.New("auth first")
 	}
 
-	sl := slack.New(config.Slack.AccessToken)
+	if len(args) == 0 {
+		return errors.New("a pattern is required ('*' for all files)")
+	}
 
-	files, err := listFiles(sl, slack.ListFilesParameters{
-		Limit: 10,
-	})
+	if global.Offline && !c.DryRun {
+		return errors.New("--offline is only for --dry-run")
+	}
+
+	sl := newSlackClient(config.Slack.AccessToken)
+
+	openCache := openFileCache
+	if !c.DryRun {
+		// not to delete by stale properties
+		openCache = openFileCacheToDelete
+	}
+	cache, err := openCache(global, sl, config.Slack.AccessToken)
+	if err != nil {
+		return err
+	}
+	names := newNameResolver(sl, cache)
+
+	sel := c.selection().selector(args, names, cache)
+	files, err := sel.selectFiles(sl)
 	if err != nil {
 		return err
 	}
@@ -83,68 +95,70 @@ func (c deleteCmd) Run(global globalCmd, args []string) error {
 		return c < 0
 	})
 
-	var patterns []glob.Glob
-	for _, a := range args {
-		patterns = append(patterns, glob.MustCompile(a))
+	if c.DryRun {
+		if c.Table {
+			t := newFileTable(c.Columns, c.RelativeTime)
+			t.Names = names
+			for _, f := range files {
+				t.add(f)
+			}
+			return t.print(os.Stdout)
+		}
+
+		for _, f := range files {
+			s, err := fileToString(c.Format, f, names)
+			if err != nil {
+				return err
+			}
+			fmt.Println(s)
+		}
+		return nil
 	}
 
-	useOlder := false
-	oldTimestamp := time.Now()
-	if c.Older != time.Duration(0) {
-		useOlder = true
-		oldTimestamp = time.Now().Add(-c.Older)
+	backup, err := newFileBackup(backupDir(c.Backup, c.NoBackup, config), config.Slack.AccessToken)
+	if err != nil {
+		return err
 	}
 
-	for _, f := range files {
-		if useOlder && !f.Timestamp.Time().Before(oldTimestamp) {
-			continue
-		}
+	results := deleteFiles(sl, files, c.Parallel, c.FailFast, backup)
 
-		matched := false
-		for _, p := range patterns {
-			for _, tgt := range c.Target {
-				if p.Match(fileProp(f, tgt)) {
-					matched = true
-					break
-				}
-			}
+	if c.Table {
+		t := newFileTable(c.Columns, c.RelativeTime)
+		t.Names = names
+		t.setPrefixHeaders("Status")
+		for _, r := range results {
+			t.add(r.File, deleteStatus(r.Err))
 		}
-		if !matched {
-			continue
+		if err := t.print(os.Stdout); err != nil {
+			return err
 		}
-
-		if c.innerChan != "" {
-			found := false
-			for _, fc := range f.Channels {
-				if c.innerChan == fc {
-					found = true
-					break
-				}
+		for _, r := range results {
+			if r.Err != nil && !errors.Is(r.Err, errSkipped) {
+				fmt.Fprintf(os.Stderr, "[FAILED] %v: %v\n", r.File.ID, r.Err)
 			}
-			for _, fc := range f.Groups {
-				if c.innerChan == fc {
-					found = true
-					break
-				}
+		}
+	} else {
+		for _, r := range results {
+			s, err := fileToString(c.Format, r.File, names)
+			if err != nil {
+				return err
 			}
-
-			if !found {
+			if r.Err != nil && !errors.Is(r.Err, errSkipped) {
+				fmt.Fprintf(os.Stderr, "[%v] %v: %v\n", deleteStatus(r.Err), s, r.Err)
 				continue
 			}
+			fmt.Printf("[%v] %v\n", deleteStatus(r.Err), s)
 		}
+	}
 
-		s, err := fileToString(c.Format, f)
-		if err != nil {
-			return err
-		}
-		println(s)
+	if err := cache.remove(deletedIDs(results)...); err != nil {
+		return err
+	}
 
-		if !c.DryRun {
-			err := sl.DeleteFile(f.ID)
-			if err != nil {
-				return err
-			}
-		}
+	summary := summarizeDeleteResults(results)
+	fmt.Println(summary)
+	if summary.Failed != 0 {
+		return fmt.Errorf("failed to delete %d files", summary.Failed)
 	}
 
 	return nil
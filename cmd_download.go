@@ -3,28 +3,33 @@ package main
 import (
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
-	"strings"
 	"time"
 
-	"github.com/gobwas/glob"
 	"github.com/shu-go/gli"
-	"github.com/slack-go/slack"
 )
 
 type downloadCmd struct {
-	_ struct{} `help:"download a file" usage:""`
+	_ struct{} `help:"download files" usage:"# download all files in a general channel into ./general\nslack-file download --chan general --dir general '*'\n# by channel and month\nslack-file download --name '{{.Channel}}/{{.Created.Time.Format \"2006-01\"}}/{{.Name}}' *.log\n# a single file\nslack-file download -o my.txt my.txt\n# to stdout\nslack-file download -o - my.txt"`
 
-	Output *string `cli:"output,o=FILE_NAME"`
+	Output *string `cli:"output,o=FILE_NAME" help:"download a single file into FILE_NAME (- for stdout)"`
+
+	Dir      string `default:"." help:"a directory files are downloaded into"`
+	Name     string `default:"{{.Name}}" help:"a template of file paths under --dir (e.g. '{{.Channel}}/{{.Created.Time.Format \"2006-01\"}}/{{.Name}}')"`
+	Conflict string `cli:"on-conflict,conflict" default:"suffix" help:"suffix, skip or overwrite an existing file"`
+
+	Parallel int `default:"4" help:"the number of concurrent downloads"`
 
 	Target gli.StrList   `default:"Name,Title,ID"`
-	Older  time.Duration `cli:"older-than,older" help:"Timestamp (e.g. '24h' for 1-day)"`
+	Older  time.Duration `cli:"older-than,older" help:"created before (e.g. '24h' for 1-day ago)"`
+	Newer  time.Duration `cli:"newer-than,newer" help:"created after (e.g. '24h' for 1-day ago)"`
 
-	Chan      string `help:"a channel name"`
-	innerChan string
+	Chan  string `help:"a channel name"`
+	User  string `help:"a user name or ID"`
+	Types string `help:"comma separated file types (spaces,snippets,images,gdocs,zips,pdfs)"`
+	Where string `help:"filter expression (e.g. 'size > 10MB && filetype == \"png\" && !isstarred && created < -30d')"`
 
 	Sort gli.StrList `default:"Name,-Timestamp,ID" help:"sort fields"`
 
@@ -35,35 +40,17 @@ func init() {
 	gApp.AddExtraCommand(&downloadCmd{}, "download,down", "")
 }
 
-func (c *downloadCmd) Before(global globalCmd) error {
-	if c.Chan != "" {
-		config, _ := loadConfig(global.Config)
-
-		if config.Slack.AccessToken == "" {
-			return errors.New("auth first")
-		}
-
-		sl := slack.New(config.Slack.AccessToken)
-
-		params := slack.GetConversationsForUserParameters{
-			Types: []string{"public_channel", "private_channel"},
-		}
-		chans, err := listConversationsForUser(sl, params)
-		if err != nil {
-			return err
-		}
-
-		for _, ch := range chans {
-			if strings.EqualFold(c.Chan, ch.Name) {
-				c.innerChan = ch.ID
-			}
-		}
-
-		if c.innerChan == "" {
-			return errors.New("no channel " + c.Chan + " found")
-		}
+// selection returns the options selecting files.
+func (c downloadCmd) selection() selectionFlags {
+	return selectionFlags{
+		Target: c.Target,
+		Older:  c.Older,
+		Newer:  c.Newer,
+		Chan:   c.Chan,
+		User:   c.User,
+		Types:  c.Types,
+		Where:  c.Where,
 	}
-	return nil
 }
 
 func (c downloadCmd) Run(global globalCmd, args []string) error {
@@ -73,11 +60,20 @@ func (c downloadCmd) Run(global globalCmd, args []string) error {
 		return errors.New("auth first")
 	}
 
-	sl := slack.New(config.Slack.AccessToken)
+	if len(args) == 0 {
+		return errors.New("a pattern is required ('*' for all files)")
+	}
 
-	files, err := listFiles(sl, slack.ListFilesParameters{
-		Limit: 10,
-	})
+	sl := newSlackClient(config.Slack.AccessToken)
+
+	cache, err := openFileCache(global, sl, config.Slack.AccessToken)
+	if err != nil {
+		return err
+	}
+	names := newNameResolver(sl, cache)
+
+	sel := c.selection().selector(args, names, cache)
+	files, err := sel.selectFiles(sl)
 	if err != nil {
 		return err
 	}
@@ -89,86 +85,77 @@ func (c downloadCmd) Run(global globalCmd, args []string) error {
 		return c < 0
 	})
 
-	var patterns []glob.Glob
-	for _, a := range args {
-		patterns = append(patterns, glob.MustCompile(a))
-	}
-
-	useOlder := false
-	oldTimestamp := time.Now()
-	if c.Older != time.Duration(0) {
-		useOlder = true
-		oldTimestamp = time.Now().Add(-c.Older)
-	}
-
-	for _, f := range files {
-		if useOlder && !f.Timestamp.Time().Before(oldTimestamp) {
-			continue
+	if c.Output != nil {
+		if len(files) != 1 {
+			return fmt.Errorf("--output needs exactly one file, %d files matched", len(files))
 		}
 
-		matched := false
-		for _, p := range patterns {
-			for _, tgt := range c.Target {
-				if p.Match(fileProp(f, tgt)) {
-					matched = true
-					break
-				}
-			}
+		if *c.Output == "-" {
+			return downloadFile(config.Slack.AccessToken, files[0], os.Stdout)
 		}
-		if len(patterns) != 0 && !matched {
-			continue
-		}
-
-		if c.innerChan != "" {
-			found := false
-			for _, fc := range f.Channels {
-				if c.innerChan == fc {
-					found = true
-					break
-				}
-			}
-			for _, fc := range f.Groups {
-				if c.innerChan == fc {
-					found = true
-					break
-				}
-			}
 
-			if !found {
-				continue
-			}
+		m, err := loadManifest(filepath.Dir(*c.Output))
+		if err != nil {
+			return err
 		}
 
-		client := http.Client{}
-		req, err := http.NewRequest("GET", f.URLPrivateDownload, nil)
+		progress := newDownloadProgress(files)
+		sum, err := downloadToFile(config.Slack.AccessToken, files[0], *c.Output, progress.file(files[0]))
+		progress.close()
 		if err != nil {
 			return err
 		}
-		req.Header.Add("Authorization", "Bearer "+config.Slack.AccessToken)
 
-		//resp, err := http.Get(f.URLPrivateDownload)
-		resp, err := client.Do(req)
+		if err := m.add(files[0], *c.Output, sum); err != nil {
+			return err
+		}
+		return m.save()
+	}
+
+	m, err := loadManifest(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	planner, err := newDownloadPlanner(c.Dir, c.Name, c.Conflict, names)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]downloadJob, len(files))
+	for i, f := range files {
+		path, skip, err := planner.plan(f)
 		if err != nil {
-			return fmt.Errorf("download %v: %v", f.URLPrivateDownload, err)
+			return err
 		}
-		defer resp.Body.Close()
+		jobs[i] = downloadJob{File: f, Path: path, Skip: skip}
+	}
 
-		// store
-		if c.Output != nil {
-			file, err := os.Create(*c.Output)
-			if err != nil {
+	progress := newDownloadProgress(files)
+	defer progress.close()
+
+	failed := 0
+	for r := range downloadFiles(config.Slack.AccessToken, jobs, c.Parallel, progress) {
+		switch {
+		case r.Skip:
+			progress.printf(os.Stdout, "[SKIPPED] %v\n", r.Path)
+		case r.Err != nil:
+			progress.printf(os.Stdout, "[FAILED] %v: %v\n", r.Path, r.Err)
+			failed++
+		default:
+			progress.printf(os.Stdout, "%v\n", r.Path)
+			if err := m.add(r.File, r.Path, r.SHA256); err != nil {
 				return err
 			}
-			defer file.Close()
-			_, err = io.Copy(file, resp.Body)
-			if err != nil {
-				return err
-			}
-		} else {
-			io.Copy(os.Stdout, resp.Body)
 		}
+	}
+
+	if err := m.save(); err != nil {
+		return err
+	}
 
-		break
+	if failed != 0 {
+		return fmt.Errorf("failed to download %d files", failed)
 	}
 
 	return nil
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/shu-go/gli"
+	"github.com/slack-go/slack"
+)
+
+type exportCmd struct {
+	_ struct{} `help:"export files and metadata into an archive" usage:"# all files in #legal in 2023\nslack-file export -o legal-2023.zip --chan legal --where 'created >= \"2023-01-01\" && created < \"2024-01-01\"'\n# to stdout\nslack-file export -o - --type tar.gz '*.pdf' > pdfs.tar.gz"`
+
+	Output string `cli:"output,o=FILE_NAME" help:"an archive file (- for stdout)"`
+	Type   string `help:"zip or tar.gz (default: by the extension of --output)"`
+
+	Target gli.StrList   `default:"Name,Title,ID"`
+	Older  time.Duration `cli:"older-than,older" help:"created before (e.g. '24h' for 1-day ago)"`
+	Newer  time.Duration `cli:"newer-than,newer" help:"created after (e.g. '24h' for 1-day ago)"`
+
+	Chan  string `help:"a channel name"`
+	User  string `help:"a user name or ID"`
+	Types string `help:"comma separated file types (spaces,snippets,images,gdocs,zips,pdfs)"`
+	Where string `help:"filter expression (e.g. 'size > 10MB && filetype == \"png\" && !isstarred && created < -30d')"`
+
+	DryRun bool `cli:"dry-run" help:"list files without exporting"`
+}
+
+func init() {
+	gApp.AddExtraCommand(&exportCmd{}, "export", "")
+}
+
+// selection returns the options selecting files.
+func (c exportCmd) selection() selectionFlags {
+	return selectionFlags{
+		Target: c.Target,
+		Older:  c.Older,
+		Newer:  c.Newer,
+		Chan:   c.Chan,
+		User:   c.User,
+		Types:  c.Types,
+		Where:  c.Where,
+	}
+}
+
+func (c exportCmd) Run(global globalCmd, args []string) error {
+	config, _ := loadConfig(global.Config)
+
+	if config.Slack.AccessToken == "" {
+		return errors.New("auth first")
+	}
+
+	if c.Output == "" {
+		return errors.New("--output is required")
+	}
+	typ, err := archiveType(c.Type, c.Output)
+	if err != nil {
+		return err
+	}
+
+	sl := newSlackClient(config.Slack.AccessToken)
+
+	cache, err := openFileCache(global, sl, config.Slack.AccessToken)
+	if err != nil {
+		return err
+	}
+	names := newNameResolver(sl, cache)
+
+	sel := c.selection().selector(args, names, cache)
+	files, err := sel.selectFiles(sl)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Created < files[j].Created
+	})
+
+	if c.DryRun {
+		for _, f := range files {
+			fmt.Printf("%v\t%v\n", f.ID, exportPath(f))
+		}
+		return nil
+	}
+
+	var w io.Writer = os.Stdout
+	if c.Output != "-" {
+		part := c.Output + ".part"
+		file, err := os.Create(part)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			file.Close()
+			os.Remove(part)
+		}()
+		w = file
+	}
+
+	if err := exportFiles(config.Slack.AccessToken, newArchiveWriter(typ, w), files, names); err != nil {
+		return err
+	}
+
+	if c.Output != "-" {
+		if err := w.(*os.File).Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(c.Output+".part", c.Output); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "exported: %d\n", len(files))
+
+	return nil
+}
+
+// exportFiles writes files and metadata.json into a.
+// Files without content (e.g. Google Docs) are only in metadata.json.
+func exportFiles(token string, a archiveWriter, files []slack.File, names *nameResolver) error {
+	progress := newDownloadProgress(files)
+	defer progress.close()
+
+	records := make([]exportRecord, 0, len(files))
+	for _, f := range files {
+		r := newExportRecord(f, names)
+
+		if f.URLPrivateDownload != "" {
+			r.Path = exportPath(f)
+
+			fp := progress.file(f)
+			sum, err := exportFile(token, a, r.Path, f, fp)
+			if err != nil {
+				return err
+			}
+			progress.finish(fp, f.Size)
+			r.SHA256 = sum
+		} else {
+			progress.finish(nil, f.Size)
+		}
+
+		records = append(records, r)
+	}
+
+	meta, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := a.create("metadata.json", int64(len(meta)), time.Now())
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(meta); err != nil {
+		return err
+	}
+
+	return a.Close()
+}
@@ -2,63 +2,53 @@ package main
 
 import (
 	"errors"
+	"os"
 	"sort"
-	"strings"
 	"time"
 
-	"github.com/gobwas/glob"
 	"github.com/shu-go/gli"
 	"github.com/slack-go/slack"
 )
 
 type listCmd struct {
-	_ struct{} `help:"list files" usage:"# list all\nslack-file list\n# find by pattern\nslack-file list my*.txt\n# files older than 1day\nslack-file list --older 24h\n# files in a general channel\nslack-file list --chan general"`
+	_ struct{} `help:"list files" usage:"# list all\nslack-file list\n# list as a table\nslack-file list --table --relative-time\n# list as JSON\nslack-file list --output json\nslack-file list --output csv --columns ID,Name,Size\n# find by pattern\nslack-file list my*.txt\n# files older than 1day\nslack-file list --older 24h\n# files in a general channel\nslack-file list --chan general"`
 
 	Target gli.StrList   `default:"Name,Title,ID"`
-	Older  time.Duration `cli:"older-than,older" help:"Timestamp (e.g. '24h' for 1-day)"`
+	Older  time.Duration `cli:"older-than,older" help:"created before (e.g. '24h' for 1-day ago)"`
+	Newer  time.Duration `cli:"newer-than,newer" help:"created after (e.g. '24h' for 1-day ago)"`
 
-	Chan      string `help:"a channel name"`
-	innerChan string
+	Chan  string `help:"a channel name"`
+	User  string `help:"a user name or ID"`
+	Types string `help:"comma separated file types (spaces,snippets,images,gdocs,zips,pdfs)"`
+	Where string `help:"filter expression (e.g. 'size > 10MB && filetype == \"png\" && !isstarred && created < -30d')"`
 
 	Sort  gli.StrList `default:"Name,-Timestamp,ID" help:"sort fields"`
 	Group gli.StrList `default:"" help:"e.g. Channels,Groups,IMs"`
 
 	Format string `default:"{{.ID}}\t{{.Timestamp.Time}}\t{{.Name}}"`
+
+	Output  string      `cli:"output,o" help:"json, ndjson, csv, tsv or yaml instead of --format"`
+	Table   bool        `help:"print aligned columns instead of --format"`
+	Columns gli.StrList `help:"properties in --output or --table (default: all, or ID,Created,Name,Title,Filetype,Size,User,Channels for csv/tsv, ID,Created,Size,Filetype,Name for --table)"`
+
+	RelativeTime bool `cli:"relative-time,rel" help:"print times as '3 days ago' in --table"`
 }
 
 func init() {
 	gApp.AddExtraCommand(&listCmd{}, "list,ls", "")
 }
 
-func (c *listCmd) Before(global globalCmd) error {
-	if c.Chan != "" {
-		config, _ := loadConfig(global.Config)
-
-		if config.Slack.AccessToken == "" {
-			return errors.New("auth first")
-		}
-
-		sl := slack.New(config.Slack.AccessToken)
-
-		params := slack.GetConversationsForUserParameters{
-			Types: []string{"public_channel", "private_channel"},
-		}
-		chans, err := listConversationsForUser(sl, params)
-		if err != nil {
-			return err
-		}
-
-		for _, ch := range chans {
-			if strings.EqualFold(c.Chan, ch.Name) {
-				c.innerChan = ch.ID
-			}
-		}
-
-		if c.innerChan == "" {
-			return errors.New("no channel " + c.Chan + " found")
-		}
+// selection returns the options selecting files.
+func (c listCmd) selection() selectionFlags {
+	return selectionFlags{
+		Target: c.Target,
+		Older:  c.Older,
+		Newer:  c.Newer,
+		Chan:   c.Chan,
+		User:   c.User,
+		Types:  c.Types,
+		Where:  c.Where,
 	}
-	return nil
 }
 
 func (c listCmd) Run(global globalCmd, args []string) error {
@@ -68,11 +58,16 @@ func (c listCmd) Run(global globalCmd, args []string) error {
 		return errors.New("auth first")
 	}
 
-	sl := slack.New(config.Slack.AccessToken)
+	sl := newSlackClient(config.Slack.AccessToken)
 
-	files, err := listFiles(sl, slack.ListFilesParameters{
-		Limit: 10,
-	})
+	cache, err := openFileCache(global, sl, config.Slack.AccessToken)
+	if err != nil {
+		return err
+	}
+	names := newNameResolver(sl, cache)
+
+	sel := c.selection().selector(args, names, cache)
+	files, err := sel.selectFiles(sl)
 	if err != nil {
 		return err
 	}
@@ -85,69 +80,37 @@ func (c listCmd) Run(global globalCmd, args []string) error {
 		return c < 0
 	})
 
-	var patterns []glob.Glob
-	for _, a := range args {
-		patterns = append(patterns, glob.MustCompile(a))
+	if c.Output != "" {
+		return writeFiles(os.Stdout, c.Output, c.Columns, files)
 	}
 
-	useOlder := false
-	oldTimestamp := time.Now()
-	if c.Older != time.Duration(0) {
-		useOlder = true
-		oldTimestamp = time.Now().Add(-c.Older)
+	if c.Table {
+		columns := []string(c.Columns)
+		if len(columns) == 0 {
+			columns = defaultTableColumns
+		}
+		t := newFileTable(append(append([]string{}, c.Group...), columns...), c.RelativeTime)
+		t.Names = names
+		for _, f := range files {
+			t.add(f)
+		}
+		return t.print(os.Stdout)
 	}
 
 	var prev *slack.File
 	for _, f := range files {
-		if useOlder && !f.Timestamp.Time().Before(oldTimestamp) {
-			continue
-		}
-
-		matched := false
-		for _, p := range patterns {
-			for _, tgt := range c.Target {
-				if p.Match(fileProp(f, tgt)) {
-					matched = true
-					break
-				}
-			}
-		}
-		if len(patterns) != 0 && !matched {
-			continue
-		}
-
-		if c.innerChan != "" {
-			found := false
-			for _, fc := range f.Channels {
-				if c.innerChan == fc {
-					found = true
-					break
-				}
-			}
-			for _, fc := range f.Groups {
-				if c.innerChan == fc {
-					found = true
-					break
-				}
-			}
-
-			if !found {
-				continue
-			}
-		}
-
 		if prev == nil || filePropsCompare(*prev, f, c.Group) != 0 {
 			if prev != nil {
 				println("")
 			}
 			for _, g := range c.Group {
-				println(fileProp(f, g))
+				println(names.fileProp(f, g))
 			}
 
 			temp := f
 			prev = &temp
 		}
-		s, err := fileToString(c.Format, f)
+		s, err := fileToString(c.Format, f, names)
 		if err != nil {
 			return err
 		}
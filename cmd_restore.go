@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/shu-go/gli"
+)
+
+type restoreCmd struct {
+	_ struct{} `help:"upload files in a backup or an exported archive again" usage:"# restore all files in a backup (see delete --backup)\nslack-file restore /path/to/backup\n# *.png into a channel\nslack-file restore --chan restored /path/to/backup '*.png'\n# from an archive of export (zip or tar.gz)\nslack-file restore legal-2023.zip"`
+
+	Target gli.StrList `default:"Name,Title,ID"`
+	Where  string      `help:"filter expression (e.g. 'size > 10MB && filetype == \"png\" && !isstarred && created < -30d')"`
+
+	Chan string `help:"a channel name to restore into (default: the original channels)"`
+
+	DryRun bool `cli:"dry-run" help:"do not upload files actually"`
+}
+
+func init() {
+	gApp.AddExtraCommand(&restoreCmd{}, "restore", "")
+}
+
+func (c restoreCmd) Run(global globalCmd, args []string) error {
+	config, _ := loadConfig(global.Config)
+
+	if config.Slack.AccessToken == "" {
+		return errors.New("auth first")
+	}
+
+	if len(args) == 0 {
+		return errors.New("a backup directory or an exported archive is required")
+	}
+
+	var entries []backupEntry
+	if info, err := os.Stat(args[0]); err == nil && !info.IsDir() {
+		var cleanup func()
+		entries, cleanup, err = loadExport(args[0])
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	} else {
+		entries, err = loadBackup(args[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	sel := fileSelector{Patterns: args[1:], Target: c.Target}
+	patterns, err := sel.compilePatterns()
+	if err != nil {
+		return err
+	}
+
+	var where whereExpr
+	if c.Where != "" {
+		where, err = compileWhere(c.Where)
+		if err != nil {
+			return err
+		}
+	}
+
+	sl := newSlackClient(config.Slack.AccessToken)
+
+	var channel string
+	if c.Chan != "" && !c.DryRun {
+		cache, err := openFileCache(global, sl, config.Slack.AccessToken)
+		if err != nil {
+			return err
+		}
+		channel, err = newNameResolver(sl, cache).channelID(c.Chan)
+		if err != nil {
+			return err
+		}
+	}
+
+	restored, failed := 0, 0
+	for _, e := range entries {
+		f := e.File
+
+		if !sel.matchPatterns(f, patterns) {
+			continue
+		}
+		if where != nil {
+			ok, err := where.eval(f)
+			if err != nil {
+				return fmt.Errorf("where %v: %v", f.ID, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if e.Path == "" {
+			fmt.Printf("[SKIPPED] %v\t%v: no content\n", f.ID, f.Name)
+			continue
+		}
+
+		var channels []string
+		if channel != "" {
+			channels = []string{channel}
+		} else {
+			channels = append(channels, f.Channels...)
+			channels = append(channels, f.Groups...)
+			channels = append(channels, f.IMs...)
+		}
+
+		if c.DryRun {
+			fmt.Printf("%v\t%v\n", f.ID, e.Path)
+			continue
+		}
+
+		newf, err := uploadLocalFile(sl, e.Path, uploadOptions{
+			Filename:       f.Name,
+			Title:          f.Title,
+			Channels:       channels,
+			InitialComment: f.InitialComment.Comment,
+		})
+		if err != nil {
+			fmt.Printf("[FAILED] %v\t%v: %v\n", f.ID, e.Path, err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("%v -> %v\t%v\n", f.ID, newf.ID, e.Path)
+		restored++
+	}
+
+	if !c.DryRun {
+		fmt.Printf("restored: %d, failed: %d\n", restored, failed)
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("failed to restore %d files", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/shu-go/gli"
+	"github.com/slack-go/slack"
+)
+
+type syncCmd struct {
+	_ struct{} `help:"mirror files into a local directory" usage:"# mirror files in general and builds into ./archive/{channel}/\nslack-file sync --chan general,builds --dir archive\n# and remove local copies of files deleted in Slack\nslack-file sync --chan builds --dir archive --prune '*.zip'"`
+
+	Dir   string `default:"." help:"a directory files are mirrored into"`
+	Name  string `default:"{{.Channel}}/{{.Name}}" help:"a template of file paths under --dir"`
+	Prune bool   `help:"remove local copies of files deleted in Slack"`
+
+	DryRun   bool `cli:"dry-run" help:"show what would be done"`
+	Parallel int  `default:"4" help:"the number of concurrent downloads"`
+
+	Target gli.StrList   `default:"Name,Title,ID"`
+	Older  time.Duration `cli:"older-than,older" help:"created before (e.g. '24h' for 1-day ago)"`
+	Newer  time.Duration `cli:"newer-than,newer" help:"created after (e.g. '24h' for 1-day ago)"`
+
+	Chan  gli.StrList `help:"comma separated channel names"`
+	User  string      `help:"a user name or ID"`
+	Types string      `help:"comma separated file types (spaces,snippets,images,gdocs,zips,pdfs)"`
+	Where string      `help:"filter expression (e.g. 'size > 10MB && filetype == \"png\" && !isstarred && created < -30d')"`
+}
+
+func init() {
+	gApp.AddExtraCommand(&syncCmd{}, "sync", "")
+}
+
+// selection returns the options selecting files. Chan is set for each of --chan.
+func (c syncCmd) selection() selectionFlags {
+	return selectionFlags{
+		Target: c.Target,
+		Older:  c.Older,
+		Newer:  c.Newer,
+		User:   c.User,
+		Types:  c.Types,
+		Where:  c.Where,
+	}
+}
+
+func (c syncCmd) Run(global globalCmd, args []string) error {
+	if c.Prune && global.Offline {
+		return errors.New("--prune can not be used with --offline")
+	}
+
+	config, _ := loadConfig(global.Config)
+
+	if config.Slack.AccessToken == "" {
+		return errors.New("auth first")
+	}
+
+	sl := newSlackClient(config.Slack.AccessToken)
+
+	cache, err := openFileCache(global, sl, config.Slack.AccessToken)
+	if err != nil {
+		return err
+	}
+	names := newNameResolver(sl, cache)
+
+	chans := []string(c.Chan)
+	if len(chans) == 0 {
+		chans = []string{""}
+	}
+
+	var files []slack.File
+	selected := make(map[string]bool)
+	for _, ch := range chans {
+		sel := c.selection().selector(args, names, cache)
+		sel.Chan = ch
+		chFiles, err := sel.selectFiles(sl)
+		if err != nil {
+			return err
+		}
+		for _, f := range chFiles {
+			if !selected[f.ID] {
+				selected[f.ID] = true
+				files = append(files, f)
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Created < files[j].Created
+	})
+
+	m, err := loadManifest(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	planner, err := newDownloadPlanner(c.Dir, c.Name, conflictSuffix, names)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]string, len(m.Files))
+	for _, key := range m.keys() {
+		keys[m.Files[key].ID] = key
+		planner.reserve(m.path(key))
+	}
+
+	var summary syncSummary
+
+	// new or changed files
+	var jobs []downloadJob
+	var updated []bool
+	for _, f := range files {
+		key, found := keys[f.ID]
+		if !found {
+			path, _, err := planner.plan(f)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, downloadJob{File: f, Path: path})
+			updated = append(updated, false)
+			continue
+		}
+
+		e := m.Files[key]
+		path := m.path(key)
+		if _, err := os.Stat(path); err == nil && e.Timestamp == int64(f.Timestamp) && e.Size == int64(f.Size) {
+			summary.Unchanged++
+			continue
+		}
+		jobs = append(jobs, downloadJob{File: f, Path: path})
+		updated = append(updated, true)
+	}
+
+	if c.DryRun {
+		for i, j := range jobs {
+			fmt.Printf("[%v] %v\n", syncStatus(updated[i], nil), j.Path)
+		}
+	} else {
+		var jobFiles []slack.File
+		for _, j := range jobs {
+			jobFiles = append(jobFiles, j.File)
+		}
+
+		progress := newDownloadProgress(jobFiles)
+		i := 0
+		for r := range downloadFiles(config.Slack.AccessToken, jobs, c.Parallel, progress) {
+			status := syncStatus(updated[i], r.Err)
+			i++
+
+			if r.Err != nil {
+				progress.printf(os.Stdout, "[%v] %v: %v\n", status, r.Path, r.Err)
+				summary.Failed++
+				continue
+			}
+			progress.printf(os.Stdout, "[%v] %v\n", status, r.Path)
+			if err := m.add(r.File, r.Path, r.SHA256); err != nil {
+				progress.close()
+				return err
+			}
+			if status == "NEW" {
+				summary.New++
+			} else {
+				summary.Updated++
+			}
+		}
+		progress.close()
+	}
+
+	// files deleted in Slack
+	if c.Prune {
+		// files.info only for files not in the channels, not to call it for every file out of the filters
+		listed := make(map[string]bool)
+		for _, ch := range chans {
+			// without the filters nor the cache (may have deleted files)
+			chFiles, err := fileSelector{Chan: ch, Names: names}.selectFiles(sl)
+			if err != nil {
+				return err
+			}
+			for _, f := range chFiles {
+				listed[f.ID] = true
+			}
+		}
+
+		for _, key := range m.keys() {
+			e := m.Files[key]
+			if listed[e.ID] {
+				continue
+			}
+
+			deleted, err := isFileDeleted(sl, e.ID)
+			if err != nil {
+				fmt.Printf("[FAILED] %v: %v\n", m.path(key), err)
+				summary.Failed++
+				continue
+			}
+			if !deleted {
+				continue
+			}
+
+			fmt.Printf("[PRUNED] %v\n", m.path(key))
+			summary.Pruned++
+			if c.DryRun {
+				continue
+			}
+
+			if err := os.Remove(m.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("[FAILED] %v: %v\n", m.path(key), err)
+				summary.Failed++
+				continue
+			}
+			delete(m.Files, key)
+		}
+	}
+
+	if !c.DryRun {
+		if err := m.save(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(summary)
+
+	if summary.Failed != 0 {
+		return fmt.Errorf("failed to sync %d files", summary.Failed)
+	}
+
+	return nil
+}
+
+// syncStatus returns NEW, UPDATED or FAILED.
+func syncStatus(updated bool, err error) string {
+	switch {
+	case err != nil:
+		return "FAILED"
+	case updated:
+		return "UPDATED"
+	default:
+		return "NEW"
+	}
+}
+
+// syncSummary counts files synced.
+type syncSummary struct {
+	New, Updated, Unchanged, Pruned, Failed int
+}
+
+func (s syncSummary) String() string {
+	return fmt.Sprintf("new: %d, updated: %d, unchanged: %d, pruned: %d, failed: %d",
+		s.New, s.Updated, s.Unchanged, s.Pruned, s.Failed)
+}
+
+// isFileDeleted tests the file of id is deleted in Slack.
+func isFileDeleted(client *slackClient, id string) (bool, error) {
+	_, err := client.GetFileInfo(id)
+	if err == nil {
+		return false, nil
+	}
+	if isFileGone(err) {
+		return true, nil
+	}
+	return false, err
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/shu-go/gli"
@@ -23,50 +26,205 @@ func fileString(f slack.File) string {
 }
 
 type uniqCmd struct {
-	_ struct{} `help:"delete duplicate files" usage:"# SIMULATE delete duplicate files by Name, keep newest Timestamp\nslack-file uniq --key Name --sort -Timestamp --dry-run\n# DELETE\nslack-file uniq --key Name --sort -Timestamp"`
+	_ struct{} `help:"delete duplicate files" usage:"# SIMULATE delete duplicate files by Name, keep newest Timestamp\nslack-file uniq --key Name --sort -Timestamp --dry-run\nslack-file uniq --key Name --sort -Timestamp --dry-run --table\n# DELETE\nslack-file uniq --key Name --sort -Timestamp\n# only *.png in a general channel\nslack-file uniq --chan general *.png\n# by contents\nslack-file uniq --key Content --dry-run\n# similar images (resized or re-encoded)\nslack-file uniq --similar-images --distance 8 --dry-run --table"`
 
-	Key  gli.StrList `default:"Name,Title" help:"a unique key set of files"`
+	Key  gli.StrList `help:"a unique key set of files (Content to compare the contents by SHA-256) (default: Name,Title)"`
 	Sort gli.StrList `default:"-Created,-Timestamp,ID" help:"sort fields of each --key group"`
 
+	Target gli.StrList   `default:"Name,Title,ID" help:"properties matched by patterns in args"`
+	Older  time.Duration `cli:"older-than,older" help:"created before (e.g. '24h' for 1-day ago)"`
+	Newer  time.Duration `cli:"newer-than,newer" help:"created after (e.g. '24h' for 1-day ago)"`
+
+	Chan  string `help:"a channel name"`
+	User  string `help:"a user name or ID"`
+	Types string `help:"comma separated file types (spaces,snippets,images,gdocs,zips,pdfs)"`
+	Where string `help:"filter expression (e.g. 'size > 10MB && filetype == \"png\" && !isstarred && created < -30d')"`
+
+	SimilarImages bool   `cli:"similar-images" help:"group images by perceptual hashes of their thumbnails instead of --key (other files are ignored)"`
+	ImageHash     string `cli:"image-hash" default:"dhash" help:"ahash or dhash for --similar-images"`
+	Distance      int    `default:"5" help:"the max Hamming distance (0-64) of hashes of similar images"`
+	Force         bool   `help:"delete by --distance over 10 without --dry-run"`
+
 	Exclude         gli.StrList `cli:"exclude,x" help:"do not delete if Name or Title are match"`
 	ExcludeProperty gli.StrList `cli:"exclude-property,xp" default:"IsStarred,IsExternal" help:"do not delete if any properties not empty"`
 
 	DryRun bool `cli:"dry-run" help:"do not delete files actually"`
 
+	Parallel int  `default:"4" help:"the number of files deleted at once"`
+	FailFast bool `cli:"fail-fast" help:"stop deleting after the first failure"`
+
+	Backup   string `cli:"backup=DIR" help:"download files and their metadata into DIR before deleting (default: Backup.Dir in the config)"`
+	NoBackup bool   `cli:"no-backup" help:"do not backup even if Backup.Dir is in the config"`
+
 	Format string `default:"{{.Name}}({{.ID}})\t{{.Timestamp.Time}}"`
+
+	Table        bool        `help:"print aligned columns instead of --format"`
+	Columns      gli.StrList `help:"properties in --table (default: ID,Created,Size,Filetype,Name)"`
+	RelativeTime bool        `cli:"relative-time,rel" help:"print times as '3 days ago' in --table"`
 }
 
-func (c uniqCmd) Run(global globalCmd) error {
+// selection returns the options selecting files.
+func (c uniqCmd) selection() selectionFlags {
+	return selectionFlags{
+		Target: c.Target,
+		Older:  c.Older,
+		Newer:  c.Newer,
+		Chan:   c.Chan,
+		User:   c.User,
+		Types:  c.Types,
+		Where:  c.Where,
+	}
+}
+
+func (c uniqCmd) Run(global globalCmd, args []string) error {
 	config, _ := loadConfig(global.Config)
 
 	if config.Slack.AccessToken == "" {
 		return errors.New("auth first")
 	}
 
-	sl := slack.New(config.Slack.AccessToken)
+	if global.Offline && !c.DryRun {
+		return errors.New("--offline is only for --dry-run")
+	}
 
-	files, err := listFiles(sl, slack.ListFilesParameters{
-		Limit: 10,
-	})
+	if c.SimilarImages {
+		if len(c.Key) != 0 {
+			return errors.New("--key can not be used with --similar-images")
+		}
+		if c.Distance < 0 || c.Distance > 64 {
+			return fmt.Errorf("--distance %v is out of 0-64", c.Distance)
+		}
+		if c.Distance > maxSafeImageDistance && !c.DryRun && !c.Force {
+			return fmt.Errorf("--distance %v may delete different images; try --dry-run first, and --force to delete", c.Distance)
+		}
+	}
+
+	sl := newSlackClient(config.Slack.AccessToken)
+
+	openCache := openFileCache
+	if !c.DryRun {
+		// not to delete by stale properties
+		openCache = openFileCacheToDelete
+	}
+	cache, err := openCache(global, sl, config.Slack.AccessToken)
 	if err != nil {
 		return err
 	}
+	names := newNameResolver(sl, cache)
+
+	sel := c.selection().selector(args, names, cache)
+	files, err := sel.selectFiles(sl)
+	if err != nil {
+		return err
+	}
+
+	keys := []string(c.Key)
+	if len(keys) == 0 {
+		keys = []string{"Name", "Title"}
+	}
+	computed := make(map[string]map[string]string)
+
+	if c.SimilarImages {
+		if global.Offline {
+			return errors.New("--similar-images can not be used with --offline")
+		}
+
+		hash, err := imageHashFunc(c.ImageHash)
+		if err != nil {
+			return err
+		}
+
+		// images only
+		var images []slack.File
+		for _, f := range files {
+			if isImageFile(f) {
+				images = append(images, f)
+			}
+		}
+		if n := len(files) - len(images); n > 0 {
+			fmt.Fprintf(os.Stderr, "%v files are not images, and ignored by --similar-images\n", n)
+		}
+		files = images
+
+		// the first file of each --sort order represents a group
+		sort.SliceStable(files, func(i, j int) bool {
+			return filePropsCompareWithKeys(files[i], files[j], c.Sort, computed) < 0
+		})
+
+		similars, failures := similarImageKeys(config.Slack.AccessToken, files, hash, c.Distance, c.Parallel)
+		for _, f := range files {
+			if err := failures[f.ID]; err != nil {
+				fmt.Fprintf(os.Stderr, "[FAILED] %v(%v): image hash: %v\n", f.Name, f.ID, err)
+			}
+		}
+
+		computed[strings.ToLower(similarImageKey)] = similars
+		keys = []string{similarImageKey}
+	}
+
+	for _, k := range keys {
+		if !isContentKey(k) {
+			continue
+		}
+
+		hashes, err := loadContentHashes(config.Slack.AccessToken)
+		if err != nil {
+			return err
+		}
+
+		contents, failures := contentKeys(config.Slack.AccessToken, files, hashes, global.Offline, c.Parallel)
+		for _, f := range files {
+			if err := failures[f.ID]; err != nil {
+				fmt.Fprintf(os.Stderr, "[FAILED] %v(%v): hash: %v\n", f.Name, f.ID, err)
+			}
+		}
+
+		if err := hashes.save(); err != nil {
+			return err
+		}
+
+		computed[strings.ToLower(contentKey)] = contents
+		break
+	}
 
 	var sortProps []string
-	sortProps = append(sortProps, c.Key...)
+	sortProps = append(sortProps, keys...)
 	sortProps = append(sortProps, c.Sort...)
-	sort.Slice(files, func(i, j int) bool {
-		c := filePropsCompare(files[i], files[j], sortProps)
+	sort.SliceStable(files, func(i, j int) bool {
+		c := filePropsCompareWithKeys(files[i], files[j], sortProps, computed)
 		return c < 0
 	})
 
-	var head *slack.File
-	for _, f := range files {
-		filestr, err := fileToString(c.Format, f)
+	var table *fileTable
+	if c.Table {
+		table = newFileTable(c.Columns, c.RelativeTime)
+		table.Names = names
+		table.setPrefixHeaders("Status")
+	}
+	report := func(status string, f slack.File) error {
+		if table != nil {
+			table.add(f, status)
+			return nil
+		}
+
+		filestr, err := fileToString(c.Format, f, names)
 		if err != nil {
 			return err
 		}
+		switch status {
+		case "EXCLUDED":
+			fmt.Printf("[EXCLUDED] %v\n", filestr)
+		case "DEL":
+			fmt.Printf("  [DEL] %v\n", filestr)
+		default:
+			fmt.Printf("%v\n", filestr)
+		}
+		return nil
+	}
 
+	var dups []slack.File
+	var head *slack.File
+	for _, f := range files {
 		excluded := false
 		for _, e := range c.Exclude {
 			ptn := glob.MustCompile(e)
@@ -82,24 +240,57 @@ func (c uniqCmd) Run(global globalCmd) error {
 			}
 		}
 		if excluded {
-			fmt.Printf("[EXCLUDED] %v\n", filestr)
+			if err := report("EXCLUDED", f); err != nil {
+				return err
+			}
 			continue
 		}
 
-		if head == nil || filePropsCompare(*head, f, c.Key) != 0 {
-			fmt.Printf("%v\n", filestr)
+		if head == nil || filePropsCompareWithKeys(*head, f, keys, computed) != 0 {
+			if err := report("", f); err != nil {
+				return err
+			}
 			curr := f
 			head = &curr
 		} else {
-			fmt.Printf("  [DEL] %v\n", filestr)
-			if !c.DryRun && !excluded {
-				err := sl.DeleteFile(f.ID)
-				if err != nil {
-					return err
-				}
+			if err := report("DEL", f); err != nil {
+				return err
 			}
+			dups = append(dups, f)
+		}
+	}
+
+	if table != nil {
+		if err := table.print(os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if c.DryRun || len(dups) == 0 {
+		return nil
+	}
+
+	backup, err := newFileBackup(backupDir(c.Backup, c.NoBackup, config), config.Slack.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	results := deleteFiles(sl, dups, c.Parallel, c.FailFast, backup)
+	for _, r := range results {
+		if r.Err != nil && !errors.Is(r.Err, errSkipped) {
+			fmt.Fprintf(os.Stderr, "[FAILED] %v(%v): %v\n", r.File.Name, r.File.ID, r.Err)
 		}
 	}
 
+	if err := cache.remove(deletedIDs(results)...); err != nil {
+		return err
+	}
+
+	summary := summarizeDeleteResults(results)
+	fmt.Println(summary)
+	if summary.Failed != 0 {
+		return fmt.Errorf("failed to delete %d files", summary.Failed)
+	}
+
 	return nil
 }
@@ -3,17 +3,37 @@ package main
 import (
 	"errors"
 	"fmt"
-	"path/filepath"
+	"os"
+	"strings"
+	"text/template"
 
+	"github.com/shu-go/gli"
 	"github.com/slack-go/slack"
 )
 
 type uploadCmd struct {
-	_ struct{} `help:"upload a file" usage:"slack-file upload --chan mychannel /path/to/myfile.log"`
+	_ struct{} `help:"upload files" usage:"slack-file upload --chan mychannel /path/to/myfile.log\n# reports of a CI job\nslack-file upload --chan ci --title '{{.Base}} ({{.ModTime.Format \"2006-01-02 15:04\"}})' report/*.html coverage.txt\n# a directory\nslack-file upload --chan ci --recursive --include '*.log' --exclude 'tmp/**' logs\n# stdin as a snippet\ngo test ./... 2>&1 | slack-file upload --chan ci --snippet --filename test.log -\n# into a thread\nslack-file upload --thread https://myteam.slack.com/archives/C0123ABCD/p1700000000123456 --comment @summary.txt deploy.log"`
 
-	Title string `help:"the title of the file"`
+	Title string `default:"{{.Base}}" help:"a template of the title ({{.Path}}, {{.Base}}, {{.Stem}}, {{.Ext}}, {{.Size}}, {{.ModTime}})"`
 
-	Chan string `default:"general"  help:"channel or group name (sub-match, posting to all matching channels and groups, no #)"`
+	Chan gli.StrList `help:"comma separated channels: names (exact or the only sub-match), #names (exact), @users (IMs) or IDs (default: #general)"`
+
+	ThreadTS string `cli:"thread-ts=TS" help:"post as a reply of the thread TS in the channel"`
+	Thread   string `cli:"thread=PERMALINK" help:"post as a reply of the thread of the message link (the channel is of the link)"`
+	Comment  string `cli:"comment=TEXT" help:"the initial message (@FILE to read from FILE)"`
+
+	Recursive bool        `cli:"recursive,r" help:"upload files in directories"`
+	Include   gli.StrList `help:"upload only files matching these globs (base names or paths relative to directories)"`
+	Exclude   gli.StrList `help:"do not upload files matching these globs (base names or paths relative to directories)"`
+
+	Filename string `help:"the file name (required for - (stdin), default: the base name)"`
+	Filetype string `help:"the file type of --snippet, an error without it (e.g. go, python, default: text)"`
+	Snippet  bool   `help:"send the content as a text snippet highlighted by --filetype"`
+
+	OnExisting   string `cli:"on-existing=MODE" help:"skip, replace (delete the old one) or suffix (name (1).ext) when the same file is in the channels"`
+	SkipExisting bool   `cli:"skip-existing" help:"same as --on-existing skip"`
+
+	DryRun bool `cli:"dry-run" help:"list files without uploading"`
 }
 
 func init() {
@@ -27,27 +47,256 @@ func (c uploadCmd) Run(global globalCmd, args []string) error {
 		return errors.New("auth first")
 	}
 
-	if len(args) != 1 {
-		return errors.New("one file is required")
+	if len(args) == 0 {
+		return errors.New("files are required")
+	}
+
+	if c.Filetype != "" && !c.Snippet {
+		return errors.New("--filetype is only for --snippet")
 	}
 
-	filename := filepath.Base(args[0])
-	if c.Title == "" {
-		c.Title = filename
+	onExisting := c.OnExisting
+	if c.SkipExisting {
+		if onExisting != "" && onExisting != existingSkip {
+			return errors.New("--skip-existing can not be used with --on-existing " + onExisting)
+		}
+		onExisting = existingSkip
+	}
+	switch onExisting {
+	case "", existingSkip, existingReplace, existingSuffix:
+	default:
+		return fmt.Errorf("unknown --on-existing %v (skip, replace or suffix)", onExisting)
 	}
 
-	sl := slack.New(config.Slack.AccessToken)
+	titleTempl, err := template.New("title").Parse(c.Title)
+	if err != nil {
+		return err
+	}
+
+	sl := newSlackClient(config.Slack.AccessToken)
+
+	specs := []string(c.Chan)
+	threadTS := c.ThreadTS
+	if c.Thread != "" {
+		if threadTS != "" || len(specs) != 0 {
+			return errors.New("--thread can not be used with --thread-ts nor --chan")
+		}
+
+		var channel string
+		channel, threadTS, err = parsePermalink(c.Thread)
+		if err != nil {
+			return err
+		}
+		specs = []string{channel}
+	}
+	if len(specs) == 0 {
+		specs = []string{"#general"}
+	}
 
-	upparams := slack.FileUploadParameters{
-		File:     args[0],
-		Channels: []string{c.Chan},
-		Title:    c.Title,
-		Filename: filename,
+	openCache := openFileCache
+	if onExisting == existingReplace {
+		// not to delete by stale properties
+		openCache = openFileCacheToDelete
 	}
-	_, err := sl.UploadFile(upparams)
+	cache, err := openCache(global, sl, config.Slack.AccessToken)
 	if err != nil {
-		return fmt.Errorf("failed to upload file %v: %v", filename, err)
+		return err
+	}
+	channels, err := resolveChannelIDs(sl, newNameResolver(sl, cache), specs)
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return errors.New("--chan is required")
+	}
+	if threadTS != "" && len(channels) != 1 {
+		return errors.New("--thread-ts needs exactly one channel")
+	}
+
+	comment, err := readComment(c.Comment)
+	if err != nil {
+		return err
+	}
+
+	opts := uploadOptions{
+		Filename:        c.Filename,
+		Filetype:        c.Filetype,
+		Channels:        channels,
+		InitialComment:  comment,
+		ThreadTimestamp: threadTS,
+		Snippet:         c.Snippet,
+	}
+
+	if len(args) == 1 && args[0] == "-" {
+		if onExisting != "" {
+			return errors.New("--on-existing is not for stdin")
+		}
+		if c.Filename == "" {
+			return errors.New("--filename is required for stdin")
+		}
+
+		opts.Title, err = uploadTitle(titleTempl, newUploadTitleDataOfName(c.Filename))
+		if err != nil {
+			return err
+		}
+
+		if c.DryRun {
+			fmt.Printf("-\t%v\n", opts.Title)
+			return nil
+		}
+
+		f, err := uploadReader(sl, os.Stdin, opts)
+		if err != nil {
+			return fmt.Errorf("failed to upload stdin: %v", err)
+		}
+		fmt.Printf("-\t%v\n", f.ID)
+		return nil
+	}
+
+	for _, arg := range args {
+		if arg == "-" {
+			return errors.New("- (stdin) can not be uploaded with other files")
+		}
+	}
+
+	paths, err := collectUploadFiles(args, c.Recursive, c.Include, c.Exclude)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return errors.New("no files to upload")
+	}
+	if c.Filename != "" && len(paths) != 1 {
+		return fmt.Errorf("--filename needs exactly one file, %d files matched", len(paths))
+	}
+
+	// files in the channels
+	var existing []slack.File
+	var hashes *contentHashes
+	if onExisting != "" {
+		found := make(map[string]bool)
+		for _, ch := range channels {
+			params := newListFilesParams(ch, "", "", 0, 0)
+
+			var files []slack.File
+			if cache != nil {
+				files = cache.selectFiles(params)
+			} else if files, err = listFiles(sl, params); err != nil {
+				return err
+			}
+
+			for _, f := range files {
+				if !found[f.ID] {
+					found[f.ID] = true
+					existing = append(existing, f)
+				}
+			}
+		}
+
+		hashes, err = loadContentHashes(config.Slack.AccessToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, path := range paths {
+		data, err := newUploadTitleData(path)
+		if err != nil {
+			return err
+		}
+		if c.Filename != "" {
+			named := newUploadTitleDataOfName(c.Filename)
+			data.Base, data.Ext, data.Stem = named.Base, named.Ext, named.Stem
+		}
+
+		var olds []slack.File
+		if onExisting != "" {
+			olds, err = findExistingFiles(existing, data.Base, path, hashes)
+			if err != nil {
+				return err
+			}
+		}
+		if len(olds) != 0 {
+			switch onExisting {
+			case existingSkip:
+				fmt.Printf("[SKIPPED] %v: %v exists\n", path, olds[0].ID)
+				continue
+			case existingSuffix:
+				named := newUploadTitleDataOfName(suffixedName(existing, data.Base))
+				data.Base, data.Ext, data.Stem = named.Base, named.Ext, named.Stem
+			}
+		}
+
+		opts.Filename = data.Base
+		opts.Title, err = uploadTitle(titleTempl, data)
+		if err != nil {
+			return err
+		}
+
+		if c.DryRun {
+			if len(olds) != 0 && onExisting == existingReplace {
+				fmt.Printf("%v\t%v\t(replacing %v)\n", path, opts.Title, fileIDs(olds))
+			} else {
+				fmt.Printf("%v\t%v\n", path, opts.Title)
+			}
+			continue
+		}
+
+		f, err := uploadLocalFile(sl, path, opts)
+		if err != nil {
+			fmt.Printf("[FAILED] %v: %v\n", path, err)
+			failed++
+			continue
+		}
+		existing = append(existing, *f)
+
+		if len(olds) == 0 || onExisting != existingReplace {
+			fmt.Printf("%v\t%v\n", path, f.ID)
+			continue
+		}
+
+		var deleted []string
+		for _, old := range olds {
+			if err := sl.DeleteFile(old.ID); err != nil {
+				fmt.Printf("[FAILED] %v: uploaded as %v, but failed to delete %v: %v\n", path, f.ID, old.ID, err)
+				failed++
+				continue
+			}
+			deleted = append(deleted, old.ID)
+		}
+		if err := cache.remove(deleted...); err != nil {
+			return err
+		}
+		existing = removeFiles(existing, deleted)
+		if len(deleted) != 0 {
+			fmt.Printf("%v\t%v\t(replaced %v)\n", path, f.ID, strings.Join(deleted, ","))
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("failed to upload %d files", failed)
 	}
 
 	return nil
 }
+
+// removeFiles returns files without those of ids.
+func removeFiles(files []slack.File, ids []string) []slack.File {
+	var rest []slack.File
+	for _, f := range files {
+		if !containsString(ids, f.ID) {
+			rest = append(rest, f)
+		}
+	}
+	return rest
+}
+
+// fileIDs returns comma separated IDs of files.
+func fileIDs(files []slack.File) string {
+	var ids []string
+	for _, f := range files {
+		ids = append(ids, f.ID)
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/slack-go/slack"
+)
+
+type verifyCmd struct {
+	_ struct{} `help:"verify downloaded files against the manifest" usage:"# check files in ./general and that they still exist in Slack\nslack-file verify general\n# check local files only\nslack-file verify --local general"`
+
+	Local bool `help:"check local files only, without the remote listing"`
+}
+
+func init() {
+	gApp.AddExtraCommand(&verifyCmd{}, "verify", "")
+}
+
+func (c verifyCmd) Run(global globalCmd, args []string) error {
+	dirs := args
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	var remote map[string]slack.File
+	if !c.Local {
+		config, _ := loadConfig(global.Config)
+
+		if config.Slack.AccessToken == "" {
+			return errors.New("auth first")
+		}
+
+		sl := newSlackClient(config.Slack.AccessToken)
+
+		cache, err := openFileCache(global, sl, config.Slack.AccessToken)
+		if err != nil {
+			return err
+		}
+
+		files, err := fileSelector{Cache: cache}.selectFiles(sl)
+		if err != nil {
+			return err
+		}
+
+		remote = make(map[string]slack.File, len(files))
+		for _, f := range files {
+			remote[f.ID] = f
+		}
+	}
+
+	failed := 0
+	for _, dir := range dirs {
+		m, err := loadManifest(dir)
+		if err != nil {
+			return err
+		}
+		if len(m.Files) == 0 {
+			return fmt.Errorf("no manifest in %v", dir)
+		}
+
+		for _, key := range m.keys() {
+			path := m.path(key)
+			status, detail := verifyEntry(m.Files[key], path, remote)
+			if detail != "" {
+				fmt.Printf("[%v] %v: %v\n", status, path, detail)
+			} else {
+				fmt.Printf("[%v] %v\n", status, path)
+			}
+			if status != "OK" && status != "DELETED" {
+				failed++
+			}
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d files failed verification", failed)
+	}
+
+	return nil
+}
+
+// verifyEntry checks the local file at path and the remote file (if remote is not nil) of e.
+// It returns OK, MISSING, BROKEN, CHANGED (remote) or DELETED (remote), and the detail.
+func verifyEntry(e manifestEntry, path string, remote map[string]slack.File) (string, string) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "MISSING", ""
+	} else if err != nil {
+		return "BROKEN", err.Error()
+	}
+
+	if info.Size() != e.Size {
+		return "BROKEN", fmt.Sprintf("%d bytes, expected %d", info.Size(), e.Size)
+	}
+
+	sum, err := hashFile(path)
+	if err != nil {
+		return "BROKEN", err.Error()
+	}
+	if sum != e.SHA256 {
+		return "BROKEN", "SHA-256 mismatch"
+	}
+
+	if remote != nil {
+		f, found := remote[e.ID]
+		if !found {
+			return "DELETED", "not found in Slack"
+		}
+		if int64(f.Size) != e.Size || int64(f.Timestamp) != e.Timestamp {
+			return "CHANGED", fmt.Sprintf("%d bytes in Slack", f.Size)
+		}
+	}
+
+	return "OK", ""
+}
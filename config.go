@@ -15,6 +15,11 @@ type config struct {
 		ClientSecret string `toml:"ClientSecret,omitempty"`
 		AccessToken  string `toml:"AccessToken,omitempty"`
 	}
+
+	Backup struct {
+		// Dir is the default of --backup of delete and uniq.
+		Dir string `toml:"Dir,omitempty"`
+	}
 }
 
 const configFileName string = "slack-file.conf"
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// contentKey is the pseudo property of --key of uniq to compare files by contents.
+const contentKey = "Content"
+
+// isContentKey tests p (e.g. Content, -content) is contentKey.
+func isContentKey(p string) bool {
+	name, _, _, _ := parseSortProp(p)
+	return strings.EqualFold(name, contentKey)
+}
+
+// hashRemoteFile downloads f and returns the SHA-256 of its content, without storing it.
+func hashRemoteFile(token string, f slack.File, progress *fileProgress) (string, error) {
+	resp, err := openDownloadRetry(token, f)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body := bufio.NewReader(resp.Body)
+	head, _ := body.Peek(512)
+	if err := checkHTMLPage(f, head); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(h, progress), body)
+	if err != nil {
+		return "", fmt.Errorf("download %v: %v", f.URLPrivateDownload, err)
+	}
+	if f.Size > 0 && n != int64(f.Size) {
+		return "", fmt.Errorf("size mismatch: %d bytes, expected %d", n, f.Size)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contentKeys returns values of contentKey of files keyed by IDs.
+//
+// Files of the same size are hashed (SHA-256), from hashes if cached, or by downloading
+// them by parallel workers unless offline. Others are unique by their sizes without downloading.
+// Files failed to hash are unique too, and returned in failures.
+func contentKeys(token string, files []slack.File, hashes *contentHashes, offline bool, parallel int) (keys map[string]string, failures map[string]error) {
+	sizes := make(map[int]int)
+	for _, f := range files {
+		sizes[f.Size]++
+	}
+
+	keys = make(map[string]string, len(files))
+	failures = make(map[string]error)
+
+	var targets []slack.File
+	for _, f := range files {
+		if sizes[f.Size] < 2 || f.URLPrivateDownload == "" {
+			keys[f.ID] = "unique:" + f.ID
+			continue
+		}
+		if sum, found := hashes.get(f); found {
+			keys[f.ID] = "sha256:" + sum
+			continue
+		}
+		if offline {
+			keys[f.ID] = "unique:" + f.ID
+			failures[f.ID] = fmt.Errorf("no hash cached")
+			continue
+		}
+		targets = append(targets, f)
+	}
+
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	progress := newDownloadProgress(targets)
+	defer progress.close()
+
+	var mu sync.Mutex
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				f := targets[i]
+
+				fp := progress.file(f)
+				sum, err := hashRemoteFile(token, f, fp)
+				progress.finish(fp, f.Size)
+
+				mu.Lock()
+				if err != nil {
+					keys[f.ID] = "unique:" + f.ID
+					failures[f.ID] = err
+				} else {
+					keys[f.ID] = "sha256:" + sum
+					hashes.set(f, sum)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range targets {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return keys, failures
+}
+
+// filePropsCompareWithKeys is filePropsCompare with pseudo properties (e.g. contentKey).
+// computed are values of the pseudo properties, keyed by lower names and file IDs.
+func filePropsCompareWithKeys(f1, f2 slack.File, props []string, computed map[string]map[string]string) int {
+	for _, p := range props {
+		var c int
+		name, desc, _, _ := parseSortProp(p)
+		if values, found := computed[strings.ToLower(name)]; found {
+			c = strings.Compare(values[f1.ID], values[f2.ID])
+			if desc {
+				c = -c
+			}
+		} else {
+			c = filePropsCompare(f1, f2, []string{p})
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// contentHashes are SHA-256 of the contents of files, stored next to the file cache.
+//
+// A hash is valid while the timestamp of the file is not changed.
+type contentHashes struct {
+	Hashes map[string]contentHash `json:"hashes"`
+
+	path string
+	mu   sync.Mutex
+}
+
+type contentHash struct {
+	SHA256    string `json:"sha256"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func loadContentHashes(token string) (*contentHashes, error) {
+	path, err := fileCachePath(token)
+	if err != nil {
+		return nil, err
+	}
+	path = strings.TrimSuffix(path, ".json") + ".hashes.json"
+
+	h := &contentHashes{
+		Hashes: make(map[string]contentHash),
+		path:   path,
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, h); err != nil {
+		return nil, fmt.Errorf("broken hash cache %v: %v", path, err)
+	}
+	if h.Hashes == nil {
+		h.Hashes = make(map[string]contentHash)
+	}
+
+	return h, nil
+}
+
+// get returns the hash of f if known.
+func (h *contentHashes) get(f slack.File) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e, found := h.Hashes[f.ID]
+	if !found || e.Timestamp != int64(f.Timestamp) {
+		return "", false
+	}
+	return e.SHA256, true
+}
+
+func (h *contentHashes) set(f slack.File, sum string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.Hashes[f.ID] = contentHash{SHA256: sum, Timestamp: int64(f.Timestamp)}
+}
+
+func (h *contentHashes) save() error {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
@@ -1,8 +1,15 @@
 package main
 
-import "github.com/slack-go/slack"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 
-func listConversationsForUser(client *slack.Client, params slack.GetConversationsForUserParameters) ([]slack.Channel, error) {
+	"github.com/slack-go/slack"
+)
+
+func listConversationsForUser(client *slackClient, params slack.GetConversationsForUserParameters) ([]slack.Channel, error) {
 	var chans []slack.Channel
 
 LOOP:
@@ -27,3 +34,154 @@ LOOP:
 
 	return chans, nil
 }
+
+func listConversations(client *slackClient, params slack.GetConversationsParameters) ([]slack.Channel, error) {
+	var chans []slack.Channel
+
+LOOP:
+	for {
+		list, nextCursor, err := client.GetConversations(&params)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(list) == 0 {
+			break LOOP
+		}
+
+		chans = append(chans, list...)
+
+		if nextCursor == "" {
+			break LOOP
+		}
+
+		params.Cursor = nextCursor
+	}
+
+	return chans, nil
+}
+
+// findChannelID returns the ID of the channel or group named name (case-insensitive).
+func findChannelID(client *slackClient, name string) (string, error) {
+	params := slack.GetConversationsForUserParameters{
+		Types: []string{"public_channel", "private_channel"},
+	}
+	chans, err := listConversationsForUser(client, params)
+	if err != nil {
+		return "", err
+	}
+
+	for _, ch := range chans {
+		if strings.EqualFold(name, ch.Name) {
+			return ch.ID, nil
+		}
+	}
+
+	return "", errors.New("no channel " + name + " found")
+}
+
+var channelIDPattern = regexp.MustCompile(`^[CGD][A-Z0-9]{8,}$`)
+
+// resolveChannelIDs resolves specs into IDs of conversations the user is a member of.
+//
+//	C0123ABCD  an ID as is
+//	#name      a channel or a group of the name (case-insensitive)
+//	@user      the IM with the user (a name or an ID)
+//	name       a channel or a group of the name, or the only one containing name
+//
+// It fails if nothing matches, or if name is contained in several names.
+func resolveChannelIDs(client *slackClient, names *nameResolver, specs []string) ([]string, error) {
+	var chans []slack.Channel
+	loaded := false
+	load := func() error {
+		if loaded {
+			return nil
+		}
+		params := slack.GetConversationsForUserParameters{
+			Types:           []string{"public_channel", "private_channel", "mpim", "im"},
+			ExcludeArchived: true,
+		}
+		var err error
+		chans, err = listConversationsForUser(client, params)
+		loaded = err == nil
+		return err
+	}
+
+	var ids []string
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		if channelIDPattern.MatchString(spec) {
+			ids = append(ids, spec)
+			continue
+		}
+
+		if err := load(); err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(spec, "@") {
+			id, err := findIMID(client, names, chans, spec[1:])
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+			continue
+		}
+
+		exact := strings.HasPrefix(spec, "#")
+		name := strings.TrimPrefix(spec, "#")
+
+		var matches []slack.Channel
+		for _, ch := range chans {
+			if ch.IsIM {
+				continue
+			}
+			if strings.EqualFold(ch.Name, name) {
+				matches = []slack.Channel{ch}
+				break
+			}
+			if !exact && strings.Contains(strings.ToLower(ch.Name), strings.ToLower(name)) {
+				matches = append(matches, ch)
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("no channel %v found", spec)
+		case 1:
+			ids = append(ids, matches[0].ID)
+		default:
+			var candidates []string
+			for _, ch := range matches {
+				candidates = append(candidates, "#"+ch.Name)
+			}
+			return nil, fmt.Errorf("%v is ambiguous (%v), give an exact #name or an ID", spec, strings.Join(candidates, ", "))
+		}
+	}
+
+	return ids, nil
+}
+
+// findIMID returns the ID of the IM with user, opening it if not in chans.
+func findIMID(client *slackClient, names *nameResolver, chans []slack.Channel, user string) (string, error) {
+	userID, err := names.userID(user)
+	if err != nil {
+		return "", err
+	}
+
+	for _, ch := range chans {
+		if ch.IsIM && ch.User == userID {
+			return ch.ID, nil
+		}
+	}
+
+	ch, err := client.OpenConversation(&slack.OpenConversationParameters{Users: []string{userID}})
+	if err != nil {
+		return "", fmt.Errorf("failed to open the IM with @%v: %v", user, err)
+	}
+	return ch.ID, nil
+}
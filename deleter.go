@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+var errSkipped = errors.New("skipped")
+
+// deleteResult is a result of deleting a file.
+// Err is errSkipped if it was not tried because of failFast.
+type deleteResult struct {
+	File slack.File
+	Err  error
+}
+
+// deleteFiles deletes files by parallel workers and returns results in the order of files.
+// With failFast, files not yet started are skipped after the first failure.
+// With backup, each file is saved before deleted, and not deleted if failed to save.
+func deleteFiles(client *slackClient, files []slack.File, parallel int, failFast bool, backup *fileBackup) []deleteResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]deleteResult, len(files))
+	indexes := make(chan int)
+
+	var mu sync.Mutex
+	failed := false
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				results[i].File = files[i]
+
+				mu.Lock()
+				skip := failFast && failed
+				mu.Unlock()
+				if skip {
+					results[i].Err = errSkipped
+					continue
+				}
+
+				var err error
+				if backup != nil {
+					if berr := backup.save(files[i]); berr != nil {
+						err = backupError{berr}
+					}
+				}
+				if err == nil {
+					err = client.DeleteFile(files[i].ID)
+				}
+				results[i].Err = err
+				if err != nil {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// deleteStatus returns DELETED, FAILED or SKIPPED.
+func deleteStatus(err error) string {
+	switch {
+	case err == nil:
+		return "DELETED"
+	case errors.Is(err, errSkipped):
+		return "SKIPPED"
+	default:
+		return "FAILED"
+	}
+}
+
+// deleteSummary counts results.
+type deleteSummary struct {
+	Deleted, Failed, Skipped int
+}
+
+func summarizeDeleteResults(results []deleteResult) deleteSummary {
+	var s deleteSummary
+	for _, r := range results {
+		switch {
+		case r.Err == nil:
+			s.Deleted++
+		case errors.Is(r.Err, errSkipped):
+			s.Skipped++
+		default:
+			s.Failed++
+		}
+	}
+	return s
+}
+
+func (s deleteSummary) String() string {
+	return fmt.Sprintf("deleted: %d, failed: %d, skipped: %d", s.Deleted, s.Failed, s.Skipped)
+}
+
+// deletedIDs returns IDs of files deleted successfully.
+func deletedIDs(results []deleteResult) []string {
+	var ids []string
+	for _, r := range results {
+		if r.Err == nil {
+			ids = append(ids, r.File.ID)
+		}
+	}
+	return ids
+}
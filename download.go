@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// downloadStatusError is an HTTP error status of a download.
+type downloadStatusError struct {
+	URL    string
+	Code   int
+	Status string
+}
+
+func (e downloadStatusError) Error() string {
+	return fmt.Sprintf("download %v: %v", e.URL, e.Status)
+}
+
+func (e downloadStatusError) HTTPStatusCode() int {
+	return e.Code
+}
+
+// openDownload requests the content of f from offset.
+// The response status is 206 if offset is accepted, 200 if the whole content is returned
+// (e.g. the content is changed from ifRange, an ETag or a Last-Modified).
+func openDownload(token string, f slack.File, offset int64, ifRange string) (*http.Response, error) {
+	return openPrivateURL(token, f.URLPrivateDownload, offset, ifRange)
+}
+
+// openPrivateURL requests a private URL of Slack (e.g. URLPrivateDownload, Thumb360) from offset.
+func openPrivateURL(token, u string, offset int64, ifRange string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	if offset > 0 {
+		req.Header.Add("Range", fmt.Sprintf("bytes=%d-", offset))
+		if ifRange != "" {
+			req.Header.Add("If-Range", ifRange)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download %v: %v", u, err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, downloadStatusError{URL: u, Code: resp.StatusCode, Status: resp.Status}
+	}
+	return resp, nil
+}
+
+// openDownloadRetry is openDownload from the beginning, retrying on network errors and 5xx.
+func openDownloadRetry(token string, f slack.File) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := openDownload(token, f, 0, "")
+		if err == nil {
+			return resp, nil
+		}
+
+		if !isRetryableDownload(err) || attempt >= maxRetries {
+			return nil, err
+		}
+		time.Sleep(backoffWait(attempt))
+	}
+}
+
+// isRetryableDownload tests err is not an error status other than 5xx and 429.
+func isRetryableDownload(err error) bool {
+	var serr downloadStatusError
+	return !errors.As(err, &serr) || serr.Code >= 500 || serr.Code == http.StatusTooManyRequests
+}
+
+// downloadFile writes the content of f into w.
+// It fails on an HTML page instead of the file (written nothing), or on a size mismatch (written partially).
+func downloadFile(token string, f slack.File, w io.Writer) error {
+	resp, err := openDownload(token, f, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := bufio.NewReader(resp.Body)
+	head, _ := body.Peek(512)
+	if err := checkHTMLPage(f, head); err != nil {
+		return err
+	}
+
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return fmt.Errorf("download %v: %v", f.URLPrivateDownload, err)
+	}
+	if f.Size > 0 && n != int64(f.Size) {
+		return fmt.Errorf("size mismatch: %d bytes, expected %d", n, f.Size)
+	}
+	return nil
+}
+
+// Conflict modes of downloadPlanner.
+const (
+	conflictSuffix    = "suffix"
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+)
+
+// downloadPlanner determines local paths of files.
+type downloadPlanner struct {
+	dir      string
+	templ    *template.Template
+	conflict string
+	names    *nameResolver
+
+	reserved map[string]bool
+}
+
+// downloadNameData is passed to the name template.
+type downloadNameData struct {
+	slack.File
+
+	// Channel is the name of the first channel, group or IM of the file (without # nor @).
+	Channel string
+}
+
+func newDownloadPlanner(dir, nameTemplate, conflict string, names *nameResolver) (*downloadPlanner, error) {
+	switch conflict {
+	case conflictSuffix, conflictSkip, conflictOverwrite:
+	default:
+		return nil, fmt.Errorf("unknown conflict mode %v (suffix, skip or overwrite)", conflict)
+	}
+
+	templ, err := template.New("name").Funcs(names.templateFuncs()).Parse(nameTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &downloadPlanner{
+		dir:      dir,
+		templ:    templ,
+		conflict: conflict,
+		names:    names,
+		reserved: make(map[string]bool),
+	}, nil
+}
+
+// plan returns the local path of f. skip is true if the path exists and conflict is skip.
+// Paths planned (or reserved) before are not returned again.
+func (p *downloadPlanner) plan(f slack.File) (path string, skip bool, err error) {
+	data := downloadNameData{File: f}
+	for _, ids := range [][]string{f.Channels, f.Groups, f.IMs} {
+		if len(ids) != 0 {
+			data.Channel = strings.TrimLeft(p.names.channelName(ids[0]), "#@")
+			break
+		}
+	}
+
+	buf := bytes.Buffer{}
+	if err := p.templ.Execute(&buf, data); err != nil {
+		return "", false, err
+	}
+
+	var elems []string
+	for _, e := range strings.Split(filepath.ToSlash(buf.String()), "/") {
+		if e = sanitizeFileName(e); e != "" {
+			elems = append(elems, e)
+		}
+	}
+	if len(elems) == 0 {
+		elems = []string{sanitizeFileName(f.ID)}
+	}
+	path = filepath.Join(append([]string{p.dir}, elems...)...)
+
+	// a path planned for another file in this run is always suffixed,
+	// not to write two files into one path. conflict is for files existing before.
+	if p.reserved[path] || (p.exists(path) && p.conflict == conflictSuffix) {
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		for i := 1; ; i++ {
+			candidate := base + " (" + strconv.Itoa(i) + ")" + ext
+			if !p.exists(candidate) {
+				path = candidate
+				break
+			}
+		}
+	} else if p.exists(path) && p.conflict == conflictSkip {
+		return path, true, nil
+	}
+
+	p.reserved[path] = true
+	return path, false, nil
+}
+
+// reserve makes path not to be planned for other files.
+func (p *downloadPlanner) reserve(path string) {
+	p.reserved[path] = true
+}
+
+func (p *downloadPlanner) exists(path string) bool {
+	if p.reserved[path] {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// sanitizeFileName replaces characters not allowed in file names.
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`\/:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// downloadJob is a file to be downloaded into Path, and its result.
+type downloadJob struct {
+	File slack.File
+	Path string
+	Skip bool
+
+	SHA256 string
+	Err    error
+}
+
+// downloadFiles downloads files of jobs by parallel workers.
+// Jobs are sent to the returned channel in the order of jobs as they are done.
+func downloadFiles(token string, jobs []downloadJob, parallel int, progress *downloadProgress) <-chan downloadJob {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	done := make([]chan struct{}, len(jobs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	indexes := make(chan int)
+	for w := 0; w < parallel; w++ {
+		go func() {
+			for i := range indexes {
+				j := &jobs[i]
+				if !j.Skip {
+					fp := progress.file(j.File)
+					j.SHA256, j.Err = downloadToFile(token, j.File, j.Path, fp)
+					progress.finish(fp, j.File.Size)
+				} else {
+					progress.finish(nil, j.File.Size)
+				}
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range jobs {
+			indexes <- i
+		}
+		close(indexes)
+	}()
+
+	results := make(chan downloadJob)
+	go func() {
+		for i := range jobs {
+			<-done[i]
+			results <- jobs[i]
+		}
+		close(results)
+	}()
+	return results
+}
+
+// downloadToFile downloads f into path, creating parent directories,
+// and returns the SHA-256 of the content.
+//
+// The content is written into path+".part" first, and renamed to path when completed and checked.
+// An existing .part file (e.g. interrupted before) is resumed by a Range request
+// if its partInfo shows it is of the same version of f.
+// Transfers are retried on network errors and 5xx.
+func downloadToFile(token string, f slack.File, path string, progress *fileProgress) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	part := path + ".part"
+	for attempt := 0; ; attempt++ {
+		err := downloadPart(token, f, part, progress)
+		if err == nil {
+			break
+		}
+
+		if !isRetryableDownload(err) || attempt >= maxRetries {
+			return "", err
+		}
+		time.Sleep(backoffWait(attempt))
+	}
+
+	if err := checkDownloaded(f, part); err != nil {
+		// not to be resumed
+		os.Remove(part)
+		os.Remove(part + partInfoExt)
+		return "", err
+	}
+
+	sum, err := hashFile(part)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(part, path); err != nil {
+		return "", err
+	}
+	os.Remove(part + partInfoExt)
+	return sum, nil
+}
+
+// partInfoExt is the extension of the partInfo of a .part file (NAME.part.json).
+const partInfoExt = ".json"
+
+// partInfo identifies the content being downloaded into a .part file,
+// not to resume a .part of another file or of an older version.
+type partInfo struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+
+	// ETag or LastModified is sent as If-Range.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// loadPartInfo returns the partInfo of part. It is empty if missing or broken.
+func loadPartInfo(part string) partInfo {
+	var info partInfo
+	if b, err := os.ReadFile(part + partInfoExt); err == nil {
+		_ = json.Unmarshal(b, &info)
+	}
+	return info
+}
+
+func (info partInfo) save(part string) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(part+partInfoExt, b, 0644)
+}
+
+func (info partInfo) ifRange() string {
+	if info.ETag != "" {
+		return info.ETag
+	}
+	return info.LastModified
+}
+
+// errRestartDownload is returned when a .part file is broken and truncated to download from byte 0.
+var errRestartDownload = errors.New("broken partial download, restarting")
+
+func downloadPart(token string, f slack.File, part string, progress *fileProgress) error {
+	file, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	info := loadPartInfo(part)
+	if offset > 0 && (info.ID != f.ID || info.Timestamp != int64(f.Timestamp)) {
+		// of another file or version
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		if offset, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	resp, err := openDownload(token, f, offset, info.ifRange())
+	if err != nil {
+		var serr downloadStatusError
+		if errors.As(err, &serr) && serr.Code == http.StatusRequestedRangeNotSatisfiable {
+			// the part may be already completed, or broken
+			if f.Size > 0 && offset == int64(f.Size) {
+				progress.set(offset)
+				return nil
+			}
+			if err := file.Truncate(0); err != nil {
+				return err
+			}
+			return errRestartDownload
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		// the whole content
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		if offset, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	progress.set(offset)
+
+	info = partInfo{
+		ID:           f.ID,
+		Timestamp:    int64(f.Timestamp),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if err := info.save(part); err != nil {
+		return err
+	}
+
+	n, err := io.Copy(io.MultiWriter(file, progress), resp.Body)
+	if err != nil {
+		return fmt.Errorf("download %v: %v", f.URLPrivateDownload, err)
+	}
+
+	if size := offset + n; f.Size > 0 && size != int64(f.Size) {
+		if size > int64(f.Size) {
+			if err := file.Truncate(0); err != nil {
+				return err
+			}
+			return errRestartDownload
+		}
+		return fmt.Errorf("download %v: %d bytes, expected %d", f.URLPrivateDownload, size, f.Size)
+	}
+	return file.Close()
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// archiveWriter writes entries into an archive one by one.
+type archiveWriter interface {
+	// create starts an entry of size bytes. size is required by tar.
+	create(name string, size int64, modTime time.Time) (io.Writer, error)
+	Close() error
+}
+
+// archiveType returns zip or tar.gz of typ, or of the extension of name if typ is empty.
+func archiveType(typ, name string) (string, error) {
+	if typ == "" {
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasSuffix(lower, ".zip"):
+			typ = "zip"
+		case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+			typ = "tar.gz"
+		default:
+			return "", fmt.Errorf("unknown archive type of %v (zip or tar.gz)", name)
+		}
+	}
+
+	switch strings.ToLower(typ) {
+	case "zip":
+		return "zip", nil
+	case "tar.gz", "tgz":
+		return "tar.gz", nil
+	default:
+		return "", fmt.Errorf("unknown archive type %v (zip or tar.gz)", typ)
+	}
+}
+
+func newArchiveWriter(typ string, w io.Writer) archiveWriter {
+	if typ == "zip" {
+		return zipArchive{zip.NewWriter(w)}
+	}
+
+	gz := gzip.NewWriter(w)
+	return &tarArchive{tw: tar.NewWriter(gz), gz: gz}
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a zipArchive) create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	return a.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
+}
+
+func (a zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+type tarArchive struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (a *tarArchive) create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.tw, nil
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// exportRecord is an entry of metadata.json of an exported archive.
+type exportRecord struct {
+	ID             string    `json:"id"`
+	Path           string    `json:"path,omitempty"`
+	Name           string    `json:"name"`
+	Title          string    `json:"title"`
+	Filetype       string    `json:"filetype"`
+	Mimetype       string    `json:"mimetype"`
+	Size           int       `json:"size"`
+	SHA256         string    `json:"sha256,omitempty"`
+	Created        time.Time `json:"created"`
+	Timestamp      time.Time `json:"timestamp"`
+	User           string    `json:"user"`
+	UserName       string    `json:"user_name"`
+	Channels       []string  `json:"channels"`
+	ChannelNames   []string  `json:"channel_names"`
+	InitialComment string    `json:"initial_comment,omitempty"`
+	CommentsCount  int       `json:"comments_count"`
+	Permalink      string    `json:"permalink"`
+
+	File slack.File `json:"file"`
+}
+
+func newExportRecord(f slack.File, names *nameResolver) exportRecord {
+	r := exportRecord{
+		ID:             f.ID,
+		Name:           f.Name,
+		Title:          f.Title,
+		Filetype:       f.Filetype,
+		Mimetype:       f.Mimetype,
+		Size:           f.Size,
+		Created:        f.Created.Time(),
+		Timestamp:      f.Timestamp.Time(),
+		User:           f.User,
+		UserName:       names.userName(f.User),
+		InitialComment: f.InitialComment.Comment,
+		CommentsCount:  f.CommentsCount,
+		Permalink:      f.Permalink,
+		File:           f,
+	}
+	for _, ids := range [][]string{f.Channels, f.Groups, f.IMs} {
+		for _, id := range ids {
+			r.Channels = append(r.Channels, id)
+			r.ChannelNames = append(r.ChannelNames, names.channelName(id))
+		}
+	}
+	return r
+}
+
+// exportPath returns the path of the content of f in an archive.
+func exportPath(f slack.File) string {
+	name := sanitizeFileName(f.Name)
+	if name == "" {
+		name = sanitizeFileName(f.ID)
+	}
+	return path.Join("files", sanitizeFileName(f.ID), name)
+}
+
+// exportFile streams the content of f into a, and returns its SHA-256.
+// A file of unknown size is spooled into a temporary file for tar.
+func exportFile(token string, a archiveWriter, name string, f slack.File, progress *fileProgress) (string, error) {
+	resp, err := openDownloadRetry(token, f)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body := bufio.NewReader(resp.Body)
+	head, _ := body.Peek(512)
+	if err := checkHTMLPage(f, head); err != nil {
+		return "", fmt.Errorf("%v: %v", f.ID, err)
+	}
+
+	var src io.Reader = body
+	size := int64(f.Size)
+	if _, isTar := a.(*tarArchive); isTar && size <= 0 {
+		tmp, err := os.CreateTemp("", "slack-file-export-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if size, err = io.Copy(tmp, body); err != nil {
+			return "", fmt.Errorf("download %v: %v", f.URLPrivateDownload, err)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		src = tmp
+	}
+
+	w, err := a.create(name, size, f.Timestamp.Time())
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h, progress), src)
+	if err != nil {
+		return "", fmt.Errorf("download %v: %v", f.URLPrivateDownload, err)
+	}
+	if f.Size > 0 && n != int64(f.Size) {
+		return "", fmt.Errorf("%v: size mismatch: %d bytes, expected %d", f.ID, n, f.Size)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extractArchive extracts regular files in an archive (zip or tar.gz by the extension of name) into dir.
+// Entries out of dir (e.g. "../x" or "/x") are errors.
+func extractArchive(name, dir string) error {
+	typ, err := archiveType("", name)
+	if err != nil {
+		return err
+	}
+
+	if typ == "zip" {
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		for _, zf := range zr.File {
+			if !zf.Mode().IsRegular() {
+				continue
+			}
+			r, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = extractEntry(dir, zf.Name, r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extractEntry(dir, h.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extractEntry(dir, name string, r io.Reader) error {
+	clean := path.Clean("/" + name)
+	if clean != "/"+strings.TrimPrefix(name, "./") || clean == "/" {
+		return fmt.Errorf("invalid entry %q in the archive", name)
+	}
+	dest := filepath.Join(dir, filepath.FromSlash(clean))
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadExport extracts an archive written by export into a temporary directory,
+// and reads files in its metadata.json in the order of Created.
+// The returned cleanup removes the directory.
+func loadExport(name string) (entries []backupEntry, cleanup func(), err error) {
+	dir, err := os.MkdirTemp("", "slack-file-restore-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	if err := extractArchive(name, dir); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("no metadata.json in %v (not exported by slack-file?)", name)
+	}
+	var records []exportRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("broken metadata.json in %v: %v", name, err)
+	}
+
+	for _, r := range records {
+		if r.File.ID == "" {
+			continue
+		}
+
+		e := backupEntry{File: r.File}
+		if r.Path != "" {
+			e.Path = filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.Path)))
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		cleanup()
+		return nil, nil, fmt.Errorf("no files in %v", name)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].File.Created < entries[j].File.Created
+	})
+
+	return entries, cleanup, nil
+}
@@ -5,12 +5,13 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/slack-go/slack"
 )
 
-func fileToString(format string, f slack.File) (string, error) {
-	templ, err := template.New("file").Parse(format)
+func fileToString(format string, f slack.File, names *nameResolver) (string, error) {
+	templ, err := template.New("file").Funcs(names.templateFuncs()).Parse(format)
 	if err != nil {
 		return "", err
 	}
@@ -25,31 +26,61 @@ func fileToString(format string, f slack.File) (string, error) {
 	return buf.String(), nil
 }
 
-func listFiles(client *slack.Client, params slack.ListFilesParameters) ([]slack.File, error) {
+// listFilesCount is the page size of files.list.
+const listFilesCount = 200
+
+func listFiles(client *slackClient, params slack.GetFilesParameters) ([]slack.File, error) {
 	var files []slack.File
 
+	if params.Count == 0 {
+		params.Count = listFilesCount
+	}
+	params.Page = 1
+
 LOOP:
 	for {
-		list, rparams, err := client.ListFiles(params)
+		list, paging, err := client.GetFiles(params)
 		if err != nil {
 			return nil, err
 		}
 
-		params = *rparams
-
 		if len(list) == 0 {
 			break LOOP
 		}
 		files = append(files, list...)
 
-		if rparams.Cursor == "" {
+		if paging == nil || paging.Page >= paging.Pages {
 			break LOOP
 		}
+
+		params.Page = paging.Page + 1
 	}
 
 	return files, nil
 }
 
+// newListFilesParams makes parameters of files.list.
+// older and newer are durations back from now. zero means not specified.
+func newListFilesParams(channel, user, types string, older, newer time.Duration) slack.GetFilesParameters {
+	params := slack.NewGetFilesParameters()
+	params.Count = listFilesCount
+	params.Channel = channel
+	params.User = user
+	if types != "" {
+		params.Types = types
+	}
+
+	now := time.Now()
+	if older != 0 {
+		params.TimestampTo = slack.JSONTime(now.Add(-older).Unix())
+	}
+	if newer != 0 {
+		params.TimestampFrom = slack.JSONTime(now.Add(-newer).Unix())
+	}
+
+	return params
+}
+
 func testProp(f slack.File, prop string) bool {
 	p := fileProp(f, prop)
 	return p != "" && p != "0"
@@ -134,6 +165,57 @@ func fileProp(f slack.File, prop string) string {
 	}
 }
 
+type propKind int
+
+const (
+	propUnknown propKind = iota
+	propString
+	propNumber
+	propTime
+	propBool
+)
+
+// filePropKind returns the type of a property that fileProp accepts.
+func filePropKind(prop string) propKind {
+	p := strings.TrimPrefix(strings.ToLower(prop), "-")
+
+	switch p {
+	case "created", "timestamp":
+		return propTime
+	case "imageexifrotation", "size", "originalh", "originalw", "lines", "linesmore", "commentscount", "numstars":
+		return propNumber
+	case "editable", "isexternal", "ispublic", "publicurlshared", "isstarred":
+		return propBool
+	case "id", "name", "title", "mimetype", "filetype", "prettytype", "user", "mode", "externaltype",
+		"urlprivate", "urlprivatedownload", "permalink", "permalinkpublic", "editlink", "preview", "previewhighlight",
+		"channels", "groups", "ims", "initialcomment":
+		return propString
+	default:
+		return propUnknown
+	}
+}
+
+// fileValue returns a property as its real type.
+// (float64 for propNumber, time.Time for propTime, bool for propBool, otherwise string)
+func fileValue(f slack.File, prop string) interface{} {
+	p := strings.TrimPrefix(strings.ToLower(prop), "-")
+
+	switch filePropKind(p) {
+	case propTime:
+		if p == "created" {
+			return f.Created.Time()
+		}
+		return f.Timestamp.Time()
+	case propNumber:
+		n, _ := strconv.ParseFloat(fileProp(f, p), 64)
+		return n
+	case propBool:
+		return fileProp(f, p) == "1"
+	default:
+		return fileProp(f, p)
+	}
+}
+
 func bool2NumStr(b bool) string {
 	if b {
 		return "1"
@@ -141,17 +223,135 @@ func bool2NumStr(b bool) string {
 	return "0"
 }
 
+// filePropsCompare compares f1 and f2 by props in order.
+//
+// Each prop is compared as its real type (see filePropKind).
+// A prefix "-" means descending order.
+// Suffixes ":i" (ignore case) and ":n" (natural order, "a2" < "a10") are for string properties.
 func filePropsCompare(f1, f2 slack.File, props []string) int {
 	for _, p := range props {
-		c := strings.Compare(fileProp(f1, p), fileProp(f2, p))
+		name, desc, ignoreCase, natural := parseSortProp(p)
+
+		var c int
+		switch v1 := fileValue(f1, name).(type) {
+		case float64:
+			c = compareFloat(v1, fileValue(f2, name).(float64))
+		case time.Time:
+			c = compareTime(v1, fileValue(f2, name).(time.Time))
+		case bool:
+			c = compareBool(v1, fileValue(f2, name).(bool))
+		default:
+			s1, s2 := fileProp(f1, name), fileProp(f2, name)
+			if ignoreCase {
+				s1, s2 = strings.ToLower(s1), strings.ToLower(s2)
+			}
+			if natural {
+				c = compareNatural(s1, s2)
+			} else {
+				c = strings.Compare(s1, s2)
+			}
+		}
 		if c == 0 {
 			continue
 		}
 
-		if strings.HasPrefix(p, "-") {
+		if desc {
 			return -c
 		}
 		return c
 	}
 	return 0
 }
+
+// parseSortProp parses "-Name:in" into ("Name", true, true, true).
+func parseSortProp(p string) (name string, desc, ignoreCase, natural bool) {
+	name = p
+	if strings.HasPrefix(name, "-") {
+		desc = true
+		name = name[1:]
+	}
+	if idx := strings.LastIndex(name, ":"); idx != -1 {
+		mods := strings.ToLower(name[idx+1:])
+		name = name[:idx]
+		ignoreCase = strings.Contains(mods, "i")
+		natural = strings.Contains(mods, "n")
+	}
+	return name, desc, ignoreCase, natural
+}
+
+// compareNatural compares strings treating digit runs as numbers.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		da, db := isDigit(a[0]), isDigit(b[0])
+		if da && db {
+			na, ra := splitDigits(a)
+			nb, rb := splitDigits(b)
+			ta, tb := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(ta) != len(tb) {
+				if len(ta) < len(tb) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(ta, tb); c != 0 {
+				return c
+			}
+			a, b = ra, rb
+			continue
+		}
+
+		if a[0] != b[0] {
+			if a[0] < b[0] {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[1:], b[1:]
+	}
+	return compareFloat(float64(len(a)), float64(len(b)))
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func splitDigits(s string) (digits, rest string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	default:
+		return 1
+	}
+}
@@ -5,18 +5,20 @@ go 1.19
 require (
 	github.com/BurntSushi/toml v1.0.0
 	github.com/gobwas/glob v0.2.3
+	github.com/mattn/go-runewidth v0.0.13
 	github.com/pkg/browser v0.0.0-20210911075715-681adbf594b8
 	github.com/shu-go/gli v1.5.2
 	github.com/shu-go/minredir v0.0.0-20220827031800-425d9f0c076a
 	github.com/slack-go/slack v0.10.2
+	golang.org/x/term v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/gorilla/websocket v1.5.0 // indirect
-	github.com/mattn/go-runewidth v0.0.13 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/shu-go/cliparser v0.2.1 // indirect
 	github.com/stretchr/testify v1.4.0 // indirect
-	golang.org/x/sys v0.0.0-20220209214540-3681064d5158 // indirect
+	golang.org/x/sys v0.10.0 // indirect
 )
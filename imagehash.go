@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// similarImageKey is the pseudo property of --key of uniq to group similar images.
+const similarImageKey = "SimilarImage"
+
+// maxSafeImageDistance is the max --distance of uniq deleting images without --force.
+// Over it, different images tend to be similar.
+const maxSafeImageDistance = 10
+
+// Perceptual hash algorithms.
+const (
+	imageHashAverage    = "ahash"
+	imageHashDifference = "dhash"
+)
+
+// imageHashFunc returns the function of algo (ahash or dhash).
+func imageHashFunc(algo string) (func(image.Image) uint64, error) {
+	switch strings.ToLower(algo) {
+	case imageHashAverage:
+		return averageHash, nil
+	case imageHashDifference:
+		return differenceHash, nil
+	default:
+		return nil, fmt.Errorf("unknown image hash %v (ahash or dhash)", algo)
+	}
+}
+
+// averageHash sets each bit of 8x8 grayscale pixels brighter than the mean.
+func averageHash(img image.Image) uint64 {
+	pixels := grayscale(img, 8, 8)
+
+	var mean float64
+	for _, p := range pixels {
+		mean += p
+	}
+	mean /= float64(len(pixels))
+
+	var h uint64
+	for i, p := range pixels {
+		if p > mean {
+			h |= 1 << uint(i)
+		}
+	}
+	return h
+}
+
+// differenceHash sets each bit of 9x8 grayscale pixels brighter than the right neighbor.
+func differenceHash(img image.Image) uint64 {
+	pixels := grayscale(img, 9, 8)
+
+	var h uint64
+	i := 0
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if pixels[y*9+x] > pixels[y*9+x+1] {
+				h |= 1 << uint(i)
+			}
+			i++
+		}
+	}
+	return h
+}
+
+// grayscale shrinks img into w x h luminances by averaging each area.
+func grayscale(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	pixels := make([]float64, w*h)
+
+	for ty := 0; ty < h; ty++ {
+		y0 := b.Min.Y + ty*b.Dy()/h
+		y1 := b.Min.Y + (ty+1)*b.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for tx := 0; tx < w; tx++ {
+			x0 := b.Min.X + tx*b.Dx()/w
+			x1 := b.Min.X + (tx+1)*b.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			pixels[ty*w+tx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	return pixels
+}
+
+// imageURL returns a thumbnail of f, or the original if no thumbnail.
+func imageURL(f slack.File) string {
+	for _, u := range []string{f.Thumb360, f.Thumb480, f.Thumb160, f.Thumb720, f.Thumb80, f.Thumb64} {
+		if u != "" {
+			return u
+		}
+	}
+	return f.URLPrivateDownload
+}
+
+// isImageFile tests f has a decodable image.
+func isImageFile(f slack.File) bool {
+	if f.Thumb360 != "" || f.Thumb160 != "" || f.Thumb64 != "" {
+		return true
+	}
+	switch f.Mimetype {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// hashRemoteImage downloads an image of f and returns its perceptual hash.
+func hashRemoteImage(token string, f slack.File, hash func(image.Image) uint64) (uint64, error) {
+	u := imageURL(f)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := openPrivateURL(token, u, 0, "")
+		if err == nil {
+			img, _, err := image.Decode(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return 0, fmt.Errorf("decode %v: %v", u, err)
+			}
+			return hash(img), nil
+		}
+
+		if !isRetryableDownload(err) || attempt >= maxRetries {
+			return 0, err
+		}
+		time.Sleep(backoffWait(attempt))
+	}
+}
+
+// similarImageKeys returns values of similarImageKey of image files keyed by IDs.
+//
+// files must be sorted by priority (--sort of uniq); see groupSimilarHashes.
+// Files failed to hash are unique, and returned in failures.
+func similarImageKeys(token string, files []slack.File, hash func(image.Image) uint64, distance, parallel int) (keys map[string]string, failures map[string]error) {
+	hashes := make([]uint64, len(files))
+	errs := make([]error, len(files))
+
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				hashes[i], errs[i] = hashRemoteImage(token, files[i], hash)
+			}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	valid := make([]bool, len(files))
+	for i := range files {
+		valid[i] = errs[i] == nil
+	}
+	reps := groupSimilarHashes(hashes, valid, distance)
+
+	keys = make(map[string]string, len(files))
+	failures = make(map[string]error)
+	for i, f := range files {
+		if errs[i] != nil {
+			failures[f.ID] = errs[i]
+		}
+		keys[f.ID] = files[reps[i]].ID
+	}
+	return keys, failures
+}
+
+// groupSimilarHashes returns the index of the representative of each hash.
+//
+// hashes are in the order of priority. Each hash joins the group of the first representative
+// within distance (Hamming distance), or represents a new group.
+// So every member of a group is similar to its representative, but not always to each other.
+// Invalid hashes (valid[i] is false) represent themselves.
+func groupSimilarHashes(hashes []uint64, valid []bool, distance int) []int {
+	reps := make([]int, len(hashes))
+	var heads []int
+	for i, h := range hashes {
+		reps[i] = i
+		if !valid[i] {
+			continue
+		}
+
+		found := false
+		for _, r := range heads {
+			if bits.OnesCount64(h^hashes[r]) <= distance {
+				reps[i] = r
+				found = true
+				break
+			}
+		}
+		if !found {
+			heads = append(heads, i)
+		}
+	}
+	return reps
+}
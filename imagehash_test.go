@@ -0,0 +1,87 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// testImage returns a w x h grayscale image of luminance f(x, y).
+func testImage(w, h int, f func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, color.Gray{Y: f(x, y)})
+		}
+	}
+	return img
+}
+
+func TestAverageHash(t *testing.T) {
+	rightHalf := func(x, y int, w int) uint8 {
+		if x >= w/2 {
+			return 255
+		}
+		return 0
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+		want uint64
+	}{
+		{"black", testImage(64, 64, func(x, y int) uint8 { return 0 }), 0},
+		{"right half 64", testImage(64, 64, func(x, y int) uint8 { return rightHalf(x, y, 64) }), 0xf0f0f0f0f0f0f0f0},
+		{"right half 200x100", testImage(200, 100, func(x, y int) uint8 { return rightHalf(x, y, 200) }), 0xf0f0f0f0f0f0f0f0},
+		{"bottom half", testImage(64, 64, func(x, y int) uint8 { return uint8(y / 32 * 255) }), 0xffffffff00000000},
+	}
+	for _, tt := range tests {
+		if got := averageHash(tt.img); got != tt.want {
+			t.Errorf("%v: averageHash() = %016x, want %016x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDifferenceHash(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		want uint64
+	}{
+		{"flat", testImage(90, 80, func(x, y int) uint8 { return 128 }), 0},
+		{"brighter to the right", testImage(90, 80, func(x, y int) uint8 { return uint8(x * 2) }), 0},
+		{"darker to the right", testImage(90, 80, func(x, y int) uint8 { return uint8(255 - x*2) }), 0xffffffffffffffff},
+		{"darker to the right, small", testImage(18, 16, func(x, y int) uint8 { return uint8(255 - x*10) }), 0xffffffffffffffff},
+	}
+	for _, tt := range tests {
+		if got := differenceHash(tt.img); got != tt.want {
+			t.Errorf("%v: differenceHash() = %016x, want %016x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGroupSimilarHashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		hashes   []uint64
+		valid    []bool
+		distance int
+		want     []int
+	}{
+		{"none", nil, nil, 5, []int{}},
+		{"same", []uint64{0xff, 0xff}, []bool{true, true}, 0, []int{0, 0}},
+		{"different", []uint64{0x00, 0xff}, []bool{true, true}, 5, []int{0, 1}},
+		{"within distance", []uint64{0x00, 0x1f}, []bool{true, true}, 5, []int{0, 0}},
+		// 0x00-0x07 and 0x07-0x3f are similar, but 0x00-0x3f are not
+		{"not chained", []uint64{0x00, 0x07, 0x3f}, []bool{true, true, true}, 3, []int{0, 0, 2}},
+		{"first representative", []uint64{0x00, 0x0f, 0x03}, []bool{true, true, true}, 2, []int{0, 1, 0}},
+		{"invalid", []uint64{0x00, 0x00, 0x00}, []bool{true, false, true}, 0, []int{0, 1, 0}},
+	}
+	for _, tt := range tests {
+		got := groupSimilarHashes(tt.hashes, tt.valid, tt.distance)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: groupSimilarHashes() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -20,6 +20,11 @@ var gApp gli.App = gli.NewWith(&globalCmd{})
 
 type globalCmd struct {
 	Config string `default:"./slack-file.conf"`
+
+	Cache    bool          `help:"use the local cache of the file list"`
+	Refresh  bool          `help:"rebuild the local cache (implies --cache)"`
+	Offline  bool          `help:"use the local cache only, without calling API (implies --cache; may be stale)"`
+	CacheTTL time.Duration `cli:"cache-ttl" default:"10m" help:"fetch new files if the cache is older than this"`
 }
 
 func main() {
@@ -75,6 +80,36 @@ initialcomment
 commentscount
 numstars
 isstarred
+
+--group: Channels, Groups, IMs and User are shown as #channel and @user
+
+--key Content: compare contents by SHA-256 (files of the same size are downloaded)
+--similar-images: group similar images instead of --key (--image-hash ahash|dhash, --distance 5)
+
+--sort: -Size (descending), Name:i (ignore case), Name:n (natural order), -Name:in
+
+---------
+ --where
+---------
+
+size > 10MB && filetype == "png" && !isstarred && created < -30d
+
+operators: || && ! ( ) == != < <= > >= =~ (regexp) !~
+numbers:   10, 1.5MB, 10KiB (B, KB, MB, GB, TB, KiB, MiB, GiB, TiB)
+durations: -30d (30 days ago; s, m, h, d, w)
+dates:     "2023-01-01", "2023-01-01 12:00"
+regexps:   /\.png$/, "\\.png$"
+booleans:  isstarred, !editable, ispublic == true
+
+----------
+ --format
+----------
+
+{{.Name}} {{channels .Channels}} {{user .User}}
+
+channel:  {{channel "C0123ABCD"}} -> #general
+channels: {{channels .Channels}}  -> #general,#random
+user:     {{user .User}}          -> alice
 `
 	gApp.Copyright = "(C) 2020 Shuhei Kubota"
 	gApp.Run(os.Args)
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// manifestFileName is the name of the manifest in a download directory.
+const manifestFileName = ".slack-file-manifest.json"
+
+// manifest records files downloaded into a directory.
+type manifest struct {
+	// Files are keyed by slash separated paths relative to the directory.
+	Files map[string]manifestEntry `json:"files"`
+
+	dir string
+}
+
+// manifestEntry is a downloaded file.
+type manifestEntry struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Timestamp int64  `json:"timestamp"`
+	SHA256    string `json:"sha256"`
+}
+
+// loadManifest loads the manifest in dir, or returns an empty one if not exists.
+func loadManifest(dir string) (*manifest, error) {
+	m := &manifest{
+		Files: make(map[string]manifestEntry),
+		dir:   dir,
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("broken manifest in %v: %v", dir, err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]manifestEntry)
+	}
+
+	return m, nil
+}
+
+func (m *manifest) save() error {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(m.dir, manifestFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// add records f downloaded into path with its SHA-256.
+func (m *manifest) add(f slack.File, path, sum string) error {
+	key, err := m.key(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	m.Files[key] = manifestEntry{
+		ID:        f.ID,
+		Name:      f.Name,
+		Size:      info.Size(),
+		Timestamp: int64(f.Timestamp),
+		SHA256:    sum,
+	}
+	return nil
+}
+
+func (m *manifest) key(path string) (string, error) {
+	rel, err := filepath.Rel(m.dir, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// path returns the local path of a key of Files.
+func (m *manifest) path(key string) string {
+	return filepath.Join(m.dir, filepath.FromSlash(key))
+}
+
+// keys returns the keys of Files in order.
+func (m *manifest) keys() []string {
+	keys := make([]string, 0, len(m.Files))
+	for k := range m.Files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hashFile returns the hex SHA-256 of the content of path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkDownloaded tests the content of f downloaded into path.
+// It fails if the size differs from f.Size, or if the content is an HTML page (see checkHTMLPage).
+func checkDownloaded(f slack.File, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	head = head[:n]
+
+	if err := checkHTMLPage(f, head); err != nil {
+		return err
+	}
+
+	if f.Size > 0 && info.Size() != int64(f.Size) {
+		return fmt.Errorf("size mismatch: %d bytes, expected %d", info.Size(), f.Size)
+	}
+
+	return nil
+}
+
+// checkHTMLPage fails if head, the beginning of the content of non-HTML f, is of an HTML page.
+// A login page is returned when the token lacks files:read.
+func checkHTMLPage(f slack.File, head []byte) error {
+	if f.Filetype != "html" && !strings.HasPrefix(f.Mimetype, "text/html") &&
+		strings.HasPrefix(http.DetectContentType(head), "text/html") {
+		return errors.New("got an HTML page instead of the file (the token may lack files:read)")
+	}
+	return nil
+}
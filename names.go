@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/slack-go/slack"
+)
+
+// nameResolver resolves IDs of channels, groups, IMs and users into names.
+//
+// conversations.list and users.list are called lazily, once for each.
+// The results are stored in the cache if given.
+// A failure is reported on stderr once, and names are left unresolved (IDs).
+type nameResolver struct {
+	client *slackClient
+	cache  *fileCache
+
+	channels map[string]string // ID -> "#name", or "@user" for IMs
+	users    map[string]string // ID -> name
+	userIDs  map[string]string // lower name, display name or real name -> ID
+
+	channelsErr error
+	usersErr    error
+}
+
+func newNameResolver(client *slackClient, cache *fileCache) *nameResolver {
+	return &nameResolver{client: client, cache: cache}
+}
+
+func (r *nameResolver) loadChannels() error {
+	if r.channels != nil {
+		return r.channelsErr
+	}
+
+	if r.cache != nil && (r.cache.Channels != nil || r.cache.offline) {
+		r.channels = r.cache.Channels
+		if r.channels == nil {
+			r.channels = make(map[string]string)
+		}
+		return nil
+	}
+
+	params := slack.GetConversationsParameters{
+		Types: []string{"public_channel", "private_channel", "mpim", "im"},
+		Limit: 1000,
+	}
+	chans, err := listConversations(r.client, params)
+	if err != nil {
+		r.channels, r.channelsErr = make(map[string]string), err
+		fmt.Fprintf(os.Stderr, "failed to load channel names: %v\n", err)
+		return err
+	}
+
+	r.channels = make(map[string]string)
+	for _, ch := range chans {
+		if ch.IsIM {
+			r.channels[ch.ID] = "@" + r.userName(ch.User)
+		} else {
+			r.channels[ch.ID] = "#" + ch.Name
+		}
+	}
+
+	if r.cache != nil {
+		r.cache.Channels = r.channels
+		return r.cache.save()
+	}
+	return nil
+}
+
+func (r *nameResolver) loadUsers() error {
+	if r.users != nil {
+		return r.usersErr
+	}
+
+	if r.cache != nil && (r.cache.Users != nil || r.cache.offline) {
+		r.users, r.userIDs = r.cache.Users, r.cache.UserIDs
+		if r.users == nil {
+			r.users, r.userIDs = make(map[string]string), make(map[string]string)
+		}
+		return nil
+	}
+
+	users, err := r.client.GetUsers()
+	if err != nil {
+		r.users, r.userIDs, r.usersErr = make(map[string]string), make(map[string]string), err
+		fmt.Fprintf(os.Stderr, "failed to load user names: %v\n", err)
+		return err
+	}
+
+	r.users = make(map[string]string)
+	r.userIDs = make(map[string]string)
+	for _, u := range users {
+		r.users[u.ID] = u.Name
+		for _, alias := range []string{u.Profile.DisplayName, u.RealName} {
+			alias = strings.ToLower(alias)
+			if _, found := r.userIDs[alias]; alias != "" && !found {
+				r.userIDs[alias] = u.ID
+			}
+		}
+	}
+	// names take priority over display names and real names
+	for _, u := range users {
+		r.userIDs[strings.ToLower(u.Name)] = u.ID
+	}
+
+	if r.cache != nil {
+		r.cache.Users, r.cache.UserIDs = r.users, r.userIDs
+		return r.cache.save()
+	}
+	return nil
+}
+
+// channelID returns the ID of a channel or a group named name (with or without #).
+// Cached names are used if any.
+func (r *nameResolver) channelID(name string) (string, error) {
+	name = strings.TrimPrefix(name, "#")
+
+	if r.cache != nil && (r.cache.Channels != nil || r.cache.offline) {
+		for id, n := range r.cache.Channels {
+			if strings.EqualFold(n, "#"+name) {
+				return id, nil
+			}
+		}
+		if r.cache.offline {
+			return "", errors.New("no channel " + name + " found in the cache")
+		}
+	}
+
+	return findChannelID(r.client, name)
+}
+
+// channelName returns "#name" of a channel or a group, "@user" of an IM, or id itself if unknown.
+func (r *nameResolver) channelName(id string) string {
+	if r == nil || r.loadChannels() != nil {
+		return id
+	}
+	if name, found := r.channels[id]; found {
+		return name
+	}
+	return id
+}
+
+// channelNames returns names of ids joined by ",".
+func (r *nameResolver) channelNames(ids []string) string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, r.channelName(id))
+	}
+	return strings.Join(names, ",")
+}
+
+// userName returns the name of a user, or id itself if unknown.
+func (r *nameResolver) userName(id string) string {
+	if r == nil || r.loadUsers() != nil {
+		return id
+	}
+	if name, found := r.users[id]; found {
+		return name
+	}
+	return id
+}
+
+var userIDPattern = regexp.MustCompile(`^[UW][A-Z0-9]{2,}$`)
+
+// userID returns the ID of a user named name (with or without @), or its display name or real name.
+// name is returned as it is if it looks like an ID.
+func (r *nameResolver) userID(name string) (string, error) {
+	name = strings.TrimPrefix(name, "@")
+	if userIDPattern.MatchString(name) {
+		return name, nil
+	}
+
+	if err := r.loadUsers(); err != nil {
+		return "", err
+	}
+	if id, found := r.userIDs[strings.ToLower(name)]; found {
+		return id, nil
+	}
+	return "", errors.New("no user " + name + " found")
+}
+
+// fileProp is fileProp with names instead of IDs of channels, groups, IMs and users.
+func (r *nameResolver) fileProp(f slack.File, prop string) string {
+	switch strings.TrimPrefix(strings.ToLower(prop), "-") {
+	case "channels":
+		return r.channelNames(f.Channels)
+	case "groups":
+		return r.channelNames(f.Groups)
+	case "ims":
+		return r.channelNames(f.IMs)
+	case "user":
+		if name := r.userName(f.User); name != f.User {
+			return "@" + name
+		}
+		return f.User
+	default:
+		return fileProp(f, prop)
+	}
+}
+
+// templateFuncs are functions available in --format.
+//
+//	{{channel "C0123ABCD"}} -> #general
+//	{{channels .Channels}}  -> #general,#random
+//	{{user .User}}          -> alice
+func (r *nameResolver) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"channel":  r.channelName,
+		"channels": r.channelNames,
+		"user":     r.userName,
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultColumns are used when output is csv or tsv and no columns are given.
+var defaultColumns = []string{"ID", "Created", "Name", "Title", "Filetype", "Size", "User", "Channels"}
+
+// writeFiles writes files to w in format (json, ndjson, csv, tsv or yaml).
+// Empty columns mean the whole slack.File (or defaultColumns for csv and tsv).
+func writeFiles(w io.Writer, format string, columns []string, files []slack.File) error {
+	for _, c := range columns {
+		if filePropKind(c) == propUnknown {
+			return fmt.Errorf("unknown column %v", c)
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(fileRecords(files, columns))
+
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, r := range fileRecords(files, columns) {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "yaml":
+		// via JSON to keep the names and the order of the json tags
+		b, err := json.Marshal(fileRecords(files, columns))
+		if err != nil {
+			return err
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(b, &node); err != nil {
+			return err
+		}
+		clearYAMLStyle(&node)
+
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return err
+		}
+		return enc.Close()
+
+	case "csv", "tsv":
+		if len(columns) == 0 {
+			columns = defaultColumns
+		}
+
+		cw := csv.NewWriter(w)
+		if strings.EqualFold(format, "tsv") {
+			cw.Comma = '\t'
+		}
+		if err := cw.Write(columns); err != nil {
+			return err
+		}
+		for _, f := range files {
+			row := make([]string, 0, len(columns))
+			for _, c := range columns {
+				row = append(row, valueString(fileValue(f, c)))
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	default:
+		return fmt.Errorf("unknown output format %v", format)
+	}
+}
+
+func fileRecords(files []slack.File, columns []string) []interface{} {
+	records := make([]interface{}, 0, len(files))
+	for _, f := range files {
+		if len(columns) == 0 {
+			records = append(records, f)
+			continue
+		}
+
+		r := make(fileRecord, 0, len(columns))
+		for _, c := range columns {
+			r = append(r, fileRecordField{Name: c, Value: fileValue(f, c)})
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// fileRecord is a set of columns of a file, ordered as given.
+type fileRecord []fileRecordField
+
+type fileRecordField struct {
+	Name  string
+	Value interface{}
+}
+
+func (r fileRecord) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// clearYAMLStyle makes JSON-like (flow and double quoted) nodes plain.
+func clearYAMLStyle(node *yaml.Node) {
+	node.Style = node.Style &^ (yaml.FlowStyle | yaml.DoubleQuotedStyle)
+	for _, c := range node.Content {
+		clearYAMLStyle(c)
+	}
+}
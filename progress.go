@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"golang.org/x/term"
+)
+
+// downloadProgress shows the progress of downloads on stderr.
+// It shows nothing unless stderr is a terminal.
+type downloadProgress struct {
+	mu sync.Mutex
+
+	enabled bool
+	total   int64
+	written int64
+	files   int
+	done    int
+	active  []*fileProgress
+
+	drawn time.Time
+}
+
+func newDownloadProgress(files []slack.File) *downloadProgress {
+	p := &downloadProgress{
+		enabled: term.IsTerminal(int(os.Stderr.Fd())),
+		files:   len(files),
+	}
+	for _, f := range files {
+		p.total += int64(f.Size)
+	}
+	return p
+}
+
+// file returns the progress of f, counted into p and shown until finish.
+func (p *downloadProgress) file(f slack.File) *fileProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fp := &fileProgress{parent: p, name: f.Name, size: int64(f.Size)}
+	p.active = append(p.active, fp)
+	return fp
+}
+
+// finish counts a file (downloaded, skipped or failed) as done.
+func (p *downloadProgress) finish(fp *fileProgress, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// the rest of the file, or not downloaded at all
+	if fp != nil {
+		p.written -= fp.written
+		for i, a := range p.active {
+			if a == fp {
+				p.active = append(p.active[:i], p.active[i+1:]...)
+				break
+			}
+		}
+	}
+	p.written += int64(size)
+	p.done++
+	p.draw(true)
+}
+
+// printf prints a line into w without breaking the progress line.
+func (p *downloadProgress) printf(w io.Writer, format string, a ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	fmt.Fprintf(w, format, a...)
+	p.draw(true)
+}
+
+// close erases the progress line.
+func (p *downloadProgress) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	p.enabled = false
+}
+
+func (p *downloadProgress) add(fp *fileProgress, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fp.written += n
+	p.written += n
+	p.draw(false)
+}
+
+func (p *downloadProgress) clear() {
+	if p.enabled {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+}
+
+func (p *downloadProgress) draw(force bool) {
+	if !p.enabled || (!force && time.Since(p.drawn) < 100*time.Millisecond) {
+		return
+	}
+	p.drawn = time.Now()
+
+	percent := 100
+	if p.total > 0 {
+		percent = int(p.written * 100 / p.total)
+	}
+	line := fmt.Sprintf("%d/%d files, %v/%v (%d%%)",
+		p.done, p.files, humanSize(p.written), humanSize(p.total), percent)
+	for _, fp := range p.active {
+		line += " | " + fp.String()
+	}
+
+	// not to wrap the line
+	if width, _, err := term.GetSize(int(os.Stderr.Fd())); err == nil && width > 1 {
+		if r := []rune(line); len(r) >= width {
+			line = string(r[:width-1])
+		}
+	}
+	fmt.Fprint(os.Stderr, "\r\x1b[K"+line)
+}
+
+// fileProgress counts bytes of a file written. A nil fileProgress counts nothing.
+//
+// written is guarded by parent.mu.
+type fileProgress struct {
+	parent  *downloadProgress
+	name    string
+	size    int64
+	written int64
+}
+
+// set resets the bytes written (e.g. resumed from offset).
+func (fp *fileProgress) set(n int64) {
+	if fp == nil {
+		return
+	}
+	p := fp.parent
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.written += n - fp.written
+	fp.written = n
+	p.draw(false)
+}
+
+func (fp *fileProgress) Write(b []byte) (int, error) {
+	if fp != nil {
+		fp.parent.add(fp, int64(len(b)))
+	}
+	return len(b), nil
+}
+
+// String formats the name and the bytes written as "name 1.5 MiB/3 MiB". It needs parent.mu locked.
+func (fp *fileProgress) String() string {
+	name := []rune(fp.name)
+	if len(name) > 24 {
+		name = append(name[:23], '…')
+	}
+	if fp.size <= 0 {
+		return fmt.Sprintf("%v %v", string(name), humanSize(fp.written))
+	}
+	return fmt.Sprintf("%v %v/%v", string(name), humanSize(fp.written), humanSize(fp.size))
+}
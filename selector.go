@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gobwas/glob"
+	"github.com/slack-go/slack"
+)
+
+// fileSelector selects files by the options common to the commands.
+type fileSelector struct {
+	// Patterns are globs matched against the Target properties.
+	// Empty Patterns match all files.
+	Patterns []string
+	Target   []string
+
+	Older time.Duration
+	Newer time.Duration
+
+	Chan  string
+	User  string
+	Types string
+
+	// Where is an expression of whereExpr.
+	Where string
+
+	// Names resolves Chan and User. A new one is made if nil.
+	Names *nameResolver
+
+	// Cache is used instead of files.list if not nil.
+	Cache *fileCache
+}
+
+// selectionFlags are the options of commands selecting files (list, delete, download, uniq, export and sync).
+//
+// gli takes a struct field as a subcommand, so they can not be embedded into the commands.
+// Instead, each command declares fields of the same names, and returns them by its selection method.
+type selectionFlags struct {
+	Target []string
+	Older  time.Duration
+	Newer  time.Duration
+	Chan   string
+	User   string
+	Types  string
+	Where  string
+}
+
+// selector returns a fileSelector of flags and patterns.
+func (flags selectionFlags) selector(patterns []string, names *nameResolver, cache *fileCache) fileSelector {
+	return fileSelector{
+		Patterns: patterns,
+		Target:   flags.Target,
+		Older:    flags.Older,
+		Newer:    flags.Newer,
+		Chan:     flags.Chan,
+		User:     flags.User,
+		Types:    flags.Types,
+		Where:    flags.Where,
+		Names:    names,
+		Cache:    cache,
+	}
+}
+
+// selectFiles lists files in the workspace and returns those matching s.
+func (s fileSelector) selectFiles(client *slackClient) ([]slack.File, error) {
+	patterns, err := s.compilePatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	var where whereExpr
+	if s.Where != "" {
+		where, err = compileWhere(s.Where)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	names := s.Names
+	if names == nil {
+		names = newNameResolver(client, s.Cache)
+	}
+
+	var channel string
+	if s.Chan != "" {
+		channel, err = names.channelID(s.Chan)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var user string
+	if s.User != "" {
+		user, err = names.userID(s.User)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	params := newListFilesParams(channel, user, s.Types, s.Older, s.Newer)
+
+	var files []slack.File
+	if s.Cache != nil {
+		files = s.Cache.selectFiles(params)
+	} else {
+		files, err = listFiles(client, params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var selected []slack.File
+	for _, f := range files {
+		if !s.matchPatterns(f, patterns) {
+			continue
+		}
+		if where != nil {
+			ok, err := where.eval(f)
+			if err != nil {
+				return nil, fmt.Errorf("where %v: %v", f.ID, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		selected = append(selected, f)
+	}
+
+	return selected, nil
+}
+
+func (s fileSelector) compilePatterns() ([]glob.Glob, error) {
+	var patterns []glob.Glob
+	for _, p := range s.Patterns {
+		g, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %v: %v", p, err)
+		}
+		patterns = append(patterns, g)
+	}
+	return patterns, nil
+}
+
+func (s fileSelector) matchPatterns(f slack.File, patterns []glob.Glob) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		for _, tgt := range s.Target {
+			if p.Match(fileProp(f, tgt)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/slack-go/slack"
+	"golang.org/x/term"
+)
+
+// defaultTableColumns are used when --table is given without --columns.
+var defaultTableColumns = []string{"ID", "Created", "Size", "Filetype", "Name"}
+
+// minTruncatedWidth is the minimum width of a truncated column.
+const minTruncatedWidth = 8
+
+// fileTable formats files as aligned columns.
+type fileTable struct {
+	Columns []string
+
+	// RelativeTime prints times as "3 days ago" instead of local times.
+	RelativeTime bool
+
+	// Width is the maximum width of a line. 0 means unlimited.
+	Width int
+
+	// Names resolves IDs in Channels, Groups, IMs and User if not nil.
+	Names *nameResolver
+
+	headers []string
+	rows    [][]string
+}
+
+func newFileTable(columns []string, relativeTime bool) *fileTable {
+	if len(columns) == 0 {
+		columns = defaultTableColumns
+	}
+	return &fileTable{
+		Columns:      columns,
+		RelativeTime: relativeTime,
+		Width:        terminalWidth(),
+	}
+}
+
+// add adds a row of f. prefix is prepended as the first cells (e.g. a status).
+func (t *fileTable) add(f slack.File, prefix ...string) {
+	row := append([]string{}, prefix...)
+	for _, c := range t.Columns {
+		row = append(row, t.cell(f, c))
+	}
+	t.rows = append(t.rows, row)
+}
+
+// setPrefixHeaders sets headers of cells given as prefix of add.
+func (t *fileTable) setPrefixHeaders(headers ...string) {
+	t.headers = headers
+}
+
+func (t *fileTable) cell(f slack.File, prop string) string {
+	var s string
+	switch v := fileValue(f, prop).(type) {
+	case time.Time:
+		if t.RelativeTime {
+			s = relativeTime(v, time.Now())
+		} else {
+			s = v.Local().Format("2006-01-02 15:04")
+		}
+	case float64:
+		if strings.EqualFold(prop, "size") {
+			s = humanSize(int64(v))
+		} else {
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	case bool:
+		if v {
+			s = "yes"
+		}
+	default:
+		if t.Names != nil {
+			s = t.Names.fileProp(f, prop)
+		} else {
+			s = fileProp(f, prop)
+		}
+	}
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// print writes the headers and the rows aligned, shrinking the widest column to fit Width.
+func (t *fileTable) print(w io.Writer) error {
+	headers := append(append([]string{}, t.headers...), t.Columns...)
+
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = runewidth.StringWidth(h)
+	}
+	for _, r := range t.rows {
+		for i, c := range r {
+			if cw := runewidth.StringWidth(c); cw > widths[i] {
+				widths[i] = cw
+			}
+		}
+	}
+
+	if t.Width > 0 {
+		for {
+			total := len(widths) - 1 // separators
+			widest := 0
+			for i, cw := range widths {
+				total += cw
+				if cw > widths[widest] {
+					widest = i
+				}
+			}
+			if total <= t.Width || widths[widest] <= minTruncatedWidth {
+				break
+			}
+			widths[widest] -= total - t.Width
+			if widths[widest] < minTruncatedWidth {
+				widths[widest] = minTruncatedWidth
+			}
+		}
+	}
+
+	if err := writeTableRow(w, headers, widths); err != nil {
+		return err
+	}
+	for _, r := range t.rows {
+		if err := writeTableRow(w, r, widths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTableRow(w io.Writer, cells []string, widths []int) error {
+	var sb strings.Builder
+	for i, c := range cells {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		c = runewidth.Truncate(c, widths[i], "…")
+		if i == len(cells)-1 {
+			sb.WriteString(c)
+		} else {
+			sb.WriteString(runewidth.FillRight(c, widths[i]))
+		}
+	}
+	sb.WriteByte('\n')
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// terminalWidth returns the width of stdout, or $COLUMNS, or 0 if unknown.
+func terminalWidth() int {
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return 0
+}
+
+// humanSize formats size in bytes as "1.5 MiB".
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// relativeTime formats t as "3 days ago" from now.
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	suffix := "ago"
+	if d < 0 {
+		d = -d
+		suffix = "later"
+	}
+
+	var n int
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = int(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		n, unit = int(d/time.Hour), "hour"
+	case d < 30*24*time.Hour:
+		n, unit = int(d/(24*time.Hour)), "day"
+	case d < 365*24*time.Hour:
+		n, unit = int(d/(30*24*time.Hour)), "month"
+	default:
+		n, unit = int(d/(365*24*time.Hour)), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s %s", n, unit, suffix)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gobwas/glob"
+	"github.com/slack-go/slack"
+)
+
+// uploadOptions are the options of a file uploaded.
+type uploadOptions struct {
+	// Filename defaults to the base name of the path.
+	Filename string
+	// Title defaults to Filename.
+	Title string
+	// Filetype is a file type of a snippet (e.g. go, python, text). Defaults to text.
+	Filetype string
+
+	// Channels are IDs or names of channels the file is shared to.
+	Channels []string
+
+	InitialComment string
+	// ThreadTimestamp posts the file as a reply of the thread in the only channel of Channels.
+	ThreadTimestamp string
+
+	// Snippet sends the content as a text snippet.
+	Snippet bool
+}
+
+// uploadLocalFile uploads the file at path.
+func uploadLocalFile(client *slackClient, path string, opts uploadOptions) (*slack.File, error) {
+	if opts.Filename == "" {
+		opts.Filename = filepath.Base(path)
+	}
+
+	if opts.Snippet {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return uploadSnippet(client, string(content), opts)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploadExternal(client, opts, info.Size(), "", func() (io.ReadCloser, error) {
+		return os.Open(path)
+	})
+}
+
+// uploadReader uploads the content read from r.
+//
+// The content is stored in a temporary file first, since the length is required before uploading.
+// With opts.Snippet, the content is read into memory and sent as a text snippet.
+func uploadReader(client *slackClient, r io.Reader, opts uploadOptions) (*slack.File, error) {
+	if opts.Snippet {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return uploadSnippet(client, string(content), opts)
+	}
+
+	tmp, err := os.CreateTemp("", "slack-file-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return uploadLocalFile(client, tmp.Name(), opts)
+}
+
+func uploadSnippet(client *slackClient, content string, opts uploadOptions) (*slack.File, error) {
+	if !utf8.ValidString(content) {
+		return nil, fmt.Errorf("%v is not a text for a snippet", opts.Filename)
+	}
+
+	snippetType := opts.Filetype
+	if snippetType == "" {
+		snippetType = "text"
+	}
+
+	return uploadExternal(client, opts, int64(len(content)), snippetType, func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(content)), nil
+	})
+}
+
+// uploadExternal uploads length bytes of open() by files.getUploadURLExternal and files.completeUploadExternal.
+func uploadExternal(client *slackClient, opts uploadOptions, length int64, snippetType string, open func() (io.ReadCloser, error)) (*slack.File, error) {
+	title := opts.Title
+	if title == "" {
+		title = opts.Filename
+	}
+
+	uploadURL, fileID, err := client.GetUploadURLExternal(opts.Filename, length, snippetType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.UploadExternalContent(uploadURL, length, open); err != nil {
+		return nil, err
+	}
+
+	return client.CompleteUploadExternal(completeUploadParameters{
+		FileID:          fileID,
+		Title:           title,
+		Channels:        opts.Channels,
+		InitialComment:  opts.InitialComment,
+		ThreadTimestamp: opts.ThreadTimestamp,
+	})
+}
+
+var permalinkPattern = regexp.MustCompile(`/archives/([A-Z0-9]+)/p(\d+)(\d{6})$`)
+
+// parsePermalink returns the channel ID and the timestamp of the thread of a message link
+// (https://WORKSPACE.slack.com/archives/C0123ABCD/p1234567890123456).
+// The parent is returned for a link of a reply (?thread_ts=...).
+func parsePermalink(link string) (channel, ts string, err error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", "", err
+	}
+
+	m := permalinkPattern.FindStringSubmatch(u.Path)
+	if m == nil {
+		return "", "", fmt.Errorf("not a message link: %v", link)
+	}
+
+	channel, ts = m[1], m[2]+"."+m[3]
+	if parent := u.Query().Get("thread_ts"); parent != "" {
+		ts = parent
+	}
+	return channel, ts, nil
+}
+
+// readComment returns text, or the content of the file if text is @path.
+// @@ is an escape of a leading @.
+func readComment(text string) (string, error) {
+	switch {
+	case strings.HasPrefix(text, "@@"):
+		return text[1:], nil
+	case strings.HasPrefix(text, "@"):
+		b, err := os.ReadFile(text[1:])
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	default:
+		return text, nil
+	}
+}
+
+// collectUploadFiles expands args (paths, globs or directories with recursive) into file paths.
+//
+// Files in directories are filtered by include and exclude, globs matched against
+// the base name or the slash separated path relative to the directory.
+func collectUploadFiles(args []string, recursive bool, include, exclude []string) ([]string, error) {
+	incl, err := compileGlobs(include)
+	if err != nil {
+		return nil, err
+	}
+	excl, err := compileGlobs(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	found := make(map[string]bool)
+	add := func(path, rel string) {
+		if len(incl) != 0 && !matchGlobs(incl, path, rel) {
+			return
+		}
+		if matchGlobs(excl, path, rel) {
+			return
+		}
+		if !found[path] {
+			found[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, arg := range args {
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err = filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("pattern %v: %v", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches %v", arg)
+			}
+		}
+
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+
+			if !info.IsDir() {
+				add(m, filepath.Base(m))
+				continue
+			}
+
+			if !recursive {
+				return nil, fmt.Errorf("%v is a directory (use --recursive)", m)
+			}
+			err = filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				rel, err := filepath.Rel(m, path)
+				if err != nil {
+					return err
+				}
+				add(path, filepath.ToSlash(rel))
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	var globs []glob.Glob
+	for _, p := range patterns {
+		g, err := glob.Compile(p, '/')
+		if err != nil {
+			return nil, fmt.Errorf("pattern %v: %v", p, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+func matchGlobs(globs []glob.Glob, path, rel string) bool {
+	base := filepath.Base(path)
+	for _, g := range globs {
+		if g.Match(base) || g.Match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadTitleData is passed to the title template.
+type uploadTitleData struct {
+	// Path is the path given or found in a directory.
+	Path string
+	// Base is the file name.
+	Base string
+	// Ext is the extension of Base (with .).
+	Ext string
+	// Stem is Base without Ext.
+	Stem string
+
+	Size    int64
+	ModTime time.Time
+}
+
+// newUploadTitleData returns the data of the file at path.
+func newUploadTitleData(path string) (uploadTitleData, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return uploadTitleData{}, err
+	}
+
+	data := newUploadTitleDataOfName(filepath.Base(path))
+	data.Path = path
+	data.Size = info.Size()
+	data.ModTime = info.ModTime()
+	return data, nil
+}
+
+// newUploadTitleDataOfName returns the data of a file without a path (e.g. stdin).
+func newUploadTitleDataOfName(base string) uploadTitleData {
+	return uploadTitleData{
+		Path:    base,
+		Base:    base,
+		Ext:     filepath.Ext(base),
+		Stem:    strings.TrimSuffix(base, filepath.Ext(base)),
+		ModTime: time.Now(),
+	}
+}
+
+// uploadTitle executes templ with data.
+func uploadTitle(templ *template.Template, data uploadTitleData) (string, error) {
+	buf := bytes.Buffer{}
+	if err := templ.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Modes of files existing in the channels.
+const (
+	existingSkip    = "skip"
+	existingReplace = "replace"
+	existingSuffix  = "suffix"
+)
+
+// findExistingFiles returns files named name with the same content as the local file at path.
+// The content is compared by the SHA-256 if the hash of a file is known (by uniq --key Content), by the size otherwise.
+func findExistingFiles(files []slack.File, name, path string, hashes *contentHashes) ([]slack.File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sum string
+	var found []slack.File
+	for _, f := range files {
+		if f.Name != name {
+			continue
+		}
+
+		if remote, ok := hashes.get(f); ok {
+			if sum == "" {
+				if sum, err = hashFile(path); err != nil {
+					return nil, err
+				}
+			}
+			if remote == sum {
+				found = append(found, f)
+			}
+		} else if int64(f.Size) == info.Size() {
+			found = append(found, f)
+		}
+	}
+	return found, nil
+}
+
+// suffixedName returns name with a version suffix (name (1).ext) not used in files, as download --on-conflict suffix.
+func suffixedName(files []slack.File, name string) string {
+	used := make(map[string]bool, len(files))
+	for _, f := range files {
+		used[f.Name] = true
+	}
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := stem + " (" + strconv.Itoa(i) + ")" + ext
+		if !used[candidate] {
+			return candidate
+		}
+	}
+}
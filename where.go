@@ -0,0 +1,577 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/slack-go/slack"
+)
+
+// whereExpr is a compiled --where expression.
+//
+// Grammar:
+//
+//	expr    = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | "(" expr ")" | operand [ op operand ]
+//	op      = "==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "!~"
+//	operand = property | number | size | duration | "string" | /regexp/ | true | false
+//
+// A size is a number followed by B, KB, MB, GB, TB, KiB, MiB, GiB or TiB.
+// A duration is a number followed by s, m, h, d or w, relative to now (e.g. -30d is 30 days ago).
+// A string compared with a time property is parsed as a date (e.g. "2023-01-01").
+// An operand without op is true if it is not empty nor zero.
+type whereExpr interface {
+	eval(f slack.File) (bool, error)
+}
+
+func compileWhere(src string) (whereExpr, error) {
+	p := whereParser{now: time.Now()}
+	if err := p.tokenize(src); err != nil {
+		return nil, fmt.Errorf("where: %v", err)
+	}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("where: %v", err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("where: unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return e, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// tokenizer
+
+type whereTokenKind int
+
+const (
+	tokOp whereTokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokRegexp
+)
+
+type whereToken struct {
+	kind  whereTokenKind
+	text  string
+	value interface{}
+}
+
+type whereParser struct {
+	tokens []whereToken
+	pos    int
+
+	now time.Time
+}
+
+var whereOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"}
+
+func (p *whereParser) tokenize(src string) error {
+	rs := []rune(src)
+	i := 0
+
+LOOP:
+	for i < len(rs) {
+		r := rs[i]
+
+		if unicode.IsSpace(r) {
+			i++
+			continue
+		}
+
+		// regexp literal after =~ or !~
+		if r == '/' && len(p.tokens) > 0 {
+			if last := p.tokens[len(p.tokens)-1]; last.kind == tokOp && (last.text == "=~" || last.text == "!~") {
+				j := i + 1
+				var sb strings.Builder
+				for ; j < len(rs) && rs[j] != '/'; j++ {
+					if rs[j] == '\\' && j+1 < len(rs) && rs[j+1] == '/' {
+						j++
+					}
+					sb.WriteRune(rs[j])
+				}
+				if j >= len(rs) {
+					return fmt.Errorf("unterminated regexp")
+				}
+				re, err := regexp.Compile(sb.String())
+				if err != nil {
+					return err
+				}
+				p.tokens = append(p.tokens, whereToken{kind: tokRegexp, text: sb.String(), value: re})
+				i = j + 1
+				continue
+			}
+		}
+
+		// string literal
+		if r == '"' || r == '\'' {
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(rs) && rs[j] != r; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+				}
+				sb.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return fmt.Errorf("unterminated string")
+			}
+			p.tokens = append(p.tokens, whereToken{kind: tokString, text: sb.String(), value: sb.String()})
+			i = j + 1
+			continue
+		}
+
+		// number (with optional unit)
+		if unicode.IsDigit(r) || (r == '-' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])) {
+			j := i + 1
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			num := string(rs[i:j])
+			k := j
+			for k < len(rs) && unicode.IsLetter(rs[k]) {
+				k++
+			}
+			v, err := p.parseNumber(num, string(rs[j:k]))
+			if err != nil {
+				return err
+			}
+			p.tokens = append(p.tokens, whereToken{kind: tokNumber, text: string(rs[i:k]), value: v})
+			i = k
+			continue
+		}
+
+		// identifier
+		if unicode.IsLetter(r) || r == '_' {
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			p.tokens = append(p.tokens, whereToken{kind: tokIdent, text: string(rs[i:j])})
+			i = j
+			continue
+		}
+
+		for _, op := range whereOps {
+			if strings.HasPrefix(string(rs[i:]), op) {
+				p.tokens = append(p.tokens, whereToken{kind: tokOp, text: op})
+				i += len([]rune(op))
+				continue LOOP
+			}
+		}
+
+		return fmt.Errorf("unexpected %q", string(r))
+	}
+
+	return nil
+}
+
+// parseNumber returns float64 for plain numbers and sizes, time.Time for durations.
+func (p *whereParser) parseNumber(num, unit string) (interface{}, error) {
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", num)
+	}
+
+	switch strings.ToLower(unit) {
+	case "":
+		return n, nil
+	case "b":
+		return n, nil
+	case "kb":
+		return n * 1000, nil
+	case "mb":
+		return n * 1000 * 1000, nil
+	case "gb":
+		return n * 1000 * 1000 * 1000, nil
+	case "tb":
+		return n * 1000 * 1000 * 1000 * 1000, nil
+	case "kib":
+		return n * (1 << 10), nil
+	case "mib":
+		return n * (1 << 20), nil
+	case "gib":
+		return n * (1 << 30), nil
+	case "tib":
+		return n * (1 << 40), nil
+	case "s":
+		return p.now.Add(time.Duration(n * float64(time.Second))), nil
+	case "m":
+		return p.now.Add(time.Duration(n * float64(time.Minute))), nil
+	case "h":
+		return p.now.Add(time.Duration(n * float64(time.Hour))), nil
+	case "d":
+		return p.now.Add(time.Duration(n * 24 * float64(time.Hour))), nil
+	case "w":
+		return p.now.Add(time.Duration(n * 7 * 24 * float64(time.Hour))), nil
+	default:
+		return nil, fmt.Errorf("unknown unit %q", unit)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// parser
+
+func (p *whereParser) peek() *whereToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *whereParser) acceptOp(ops ...string) string {
+	t := p.peek()
+	if t == nil || t.kind != tokOp {
+		return ""
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *whereParser) parseOr() (whereExpr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("||") != "" {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = whereOr{l, r}
+	}
+	return l, nil
+}
+
+func (p *whereParser) parseAnd() (whereExpr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("&&") != "" {
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = whereAnd{l, r}
+	}
+	return l, nil
+}
+
+func (p *whereParser) parseUnary() (whereExpr, error) {
+	if p.acceptOp("!") != "" {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return whereNot{e}, nil
+	}
+
+	if p.acceptOp("(") != "" {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.acceptOp(")") == "" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return e, nil
+	}
+
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.acceptOp("==", "!=", "<=", ">=", "=~", "!~", "<", ">")
+	if op == "" {
+		return whereTruth{l}, nil
+	}
+
+	r, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if op == "=~" || op == "!~" {
+		lit, ok := r.(whereLiteral)
+		if !ok {
+			return nil, fmt.Errorf("right side of %v must be a regexp", op)
+		}
+		if s, ok := lit.v.(string); ok {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, err
+			}
+			r = whereLiteral{re}
+		} else if _, ok := lit.v.(*regexp.Regexp); !ok {
+			return nil, fmt.Errorf("right side of %v must be a regexp", op)
+		}
+	}
+
+	return whereCompare{op: op, l: l, r: r}, nil
+}
+
+func (p *whereParser) parseOperand() (whereOperand, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	p.pos++
+
+	switch t.kind {
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return whereLiteral{true}, nil
+		case "false":
+			return whereLiteral{false}, nil
+		}
+		if filePropKind(t.text) == propUnknown {
+			return nil, fmt.Errorf("unknown property %q", t.text)
+		}
+		return whereProp(t.text), nil
+	case tokNumber, tokString, tokRegexp:
+		return whereLiteral{t.value}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// evaluation
+
+type whereOr struct{ l, r whereExpr }
+
+func (e whereOr) eval(f slack.File) (bool, error) {
+	l, err := e.l.eval(f)
+	if err != nil || l {
+		return l, err
+	}
+	return e.r.eval(f)
+}
+
+type whereAnd struct{ l, r whereExpr }
+
+func (e whereAnd) eval(f slack.File) (bool, error) {
+	l, err := e.l.eval(f)
+	if err != nil || !l {
+		return false, err
+	}
+	return e.r.eval(f)
+}
+
+type whereNot struct{ e whereExpr }
+
+func (e whereNot) eval(f slack.File) (bool, error) {
+	b, err := e.e.eval(f)
+	return !b, err
+}
+
+type whereOperand interface {
+	value(f slack.File) interface{}
+}
+
+type whereProp string
+
+func (o whereProp) value(f slack.File) interface{} {
+	return fileValue(f, string(o))
+}
+
+type whereLiteral struct {
+	v interface{}
+}
+
+func (o whereLiteral) value(slack.File) interface{} {
+	return o.v
+}
+
+type whereTruth struct{ o whereOperand }
+
+func (e whereTruth) eval(f slack.File) (bool, error) {
+	switch v := e.o.value(f).(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	case time.Time:
+		return !v.IsZero() && v.Unix() != 0, nil
+	case string:
+		return v != "" && v != "0", nil
+	default:
+		return false, fmt.Errorf("%v can not be a condition", v)
+	}
+}
+
+type whereCompare struct {
+	op   string
+	l, r whereOperand
+}
+
+func (e whereCompare) eval(f slack.File) (bool, error) {
+	lv := e.l.value(f)
+	rv := e.r.value(f)
+
+	if re, ok := rv.(*regexp.Regexp); ok {
+		m := re.MatchString(valueString(lv))
+		if e.op == "!~" {
+			return !m, nil
+		}
+		return m, nil
+	}
+
+	c, err := whereValuesCompare(lv, rv)
+	if err != nil {
+		return false, err
+	}
+
+	switch e.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	default:
+		return false, fmt.Errorf("unknown operator %v", e.op)
+	}
+}
+
+// whereValuesCompare compares a and b, converting one to the type of the other.
+// time > number > bool > string in precedence.
+func whereValuesCompare(a, b interface{}) (int, error) {
+	switch {
+	case isTime(a) || isTime(b):
+		ta, err := whereToTime(a)
+		if err != nil {
+			return 0, err
+		}
+		tb, err := whereToTime(b)
+		if err != nil {
+			return 0, err
+		}
+		return compareTime(ta, tb), nil
+
+	case isNumber(a) || isNumber(b):
+		na, err := whereToNumber(a)
+		if err != nil {
+			return 0, err
+		}
+		nb, err := whereToNumber(b)
+		if err != nil {
+			return 0, err
+		}
+		return compareFloat(na, nb), nil
+
+	case isBool(a) || isBool(b):
+		ba, err := strconv.ParseBool(valueString(a))
+		if err != nil {
+			return 0, err
+		}
+		bb, err := strconv.ParseBool(valueString(b))
+		if err != nil {
+			return 0, err
+		}
+		return compareBool(ba, bb), nil
+
+	default:
+		return strings.Compare(valueString(a), valueString(b)), nil
+	}
+}
+
+func isTime(v interface{}) bool {
+	_, ok := v.(time.Time)
+	return ok
+}
+
+func isNumber(v interface{}) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+func isBool(v interface{}) bool {
+	_, ok := v.(bool)
+	return ok
+}
+
+var whereTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"2006-01",
+}
+
+func whereToTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case float64:
+		return time.Unix(int64(v), 0), nil
+	case string:
+		for _, l := range whereTimeLayouts {
+			if t, err := time.ParseInLocation(l, v, time.Local); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("%q is not a date", v)
+	default:
+		return time.Time{}, fmt.Errorf("%v is not a date", v)
+	}
+}
+
+func whereToNumber(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("%v is not a number", v)
+	}
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
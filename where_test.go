@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestCompileWhere(t *testing.T) {
+	now := time.Now()
+	daysAgo := func(d int) slack.JSONTime {
+		return slack.JSONTime(now.Add(-time.Duration(d) * 24 * time.Hour).Unix())
+	}
+
+	png := slack.File{ID: "F1", Name: "a.png", Filetype: "png", Size: 5 * 1000 * 1000, Created: daysAgo(10), IsStarred: true}
+	txt := slack.File{ID: "F2", Name: "b.txt", Filetype: "text", Size: 2048, Created: daysAgo(40)}
+
+	tests := []struct {
+		src  string
+		f    slack.File
+		want bool
+	}{
+		// comparison
+		{`filetype == "png"`, png, true},
+		{`filetype == 'png'`, txt, false},
+		{`filetype != "png"`, txt, true},
+		{`name =~ /\.png$/`, png, true},
+		{`name !~ /\.png$/`, png, false},
+
+		// precedence: && binds tighter than ||
+		{`filetype == "text" || filetype == "png" && size > 10MB`, txt, true},
+		{`filetype == "text" || filetype == "png" && size > 10MB`, png, false},
+		{`(filetype == "text" || filetype == "png") && size > 10MB`, txt, false},
+		{`filetype == "png" && size > 1MB || isstarred`, txt, false},
+
+		// !
+		{`!isstarred`, png, false},
+		{`!isstarred`, txt, true},
+		{`!!isstarred`, png, true},
+		{`!size > 1MB`, txt, true},
+		{`!(isstarred || size > 1KB)`, txt, false},
+
+		// size units
+		{`size == 5MB`, png, true},
+		{`size > 4.9MB && size < 5.1MB`, png, true},
+		{`size == 2KiB`, txt, true},
+		{`size == 2KB`, txt, false},
+		{`size < 1GB`, png, true},
+		{`size <= 2048B`, txt, true},
+
+		// relative dates
+		{`created < -7d`, png, true},
+		{`created < -30d`, png, false},
+		{`created < -30d`, txt, true},
+		{`created > -2w`, png, true},
+		{`created > -2w`, txt, false},
+		{`created > -240h`, png, false},
+
+		// absolute dates
+		{`created >= "2000-01-01"`, png, true},
+		{`created < "2000-01-01"`, png, false},
+
+		// truth of operands
+		{`isstarred`, png, true},
+		{`isstarred == true`, txt, false},
+		{`size`, txt, true},
+	}
+	for _, tt := range tests {
+		e, err := compileWhere(tt.src)
+		if err != nil {
+			t.Errorf("compileWhere(%q): %v", tt.src, err)
+			continue
+		}
+
+		got, err := e.eval(tt.f)
+		if err != nil {
+			t.Errorf("%q of %v: %v", tt.src, tt.f.Name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q of %v = %v, want %v", tt.src, tt.f.Name, got, tt.want)
+		}
+	}
+}
+
+func TestCompileWhereErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`size >`,
+		`size > 10XB`,
+		`(size > 1`,
+		`size > 1)`,
+		`size > 1 &&`,
+		`&& size > 1`,
+		`name == "a.png`,
+		`name =~ /a`,
+		`name =~ /(/`,
+		`name == #`,
+		`size 1`,
+	}
+	for _, src := range tests {
+		if _, err := compileWhere(src); err == nil {
+			t.Errorf("compileWhere(%q) must be an error", src)
+		}
+	}
+}